@@ -0,0 +1,139 @@
+package db
+
+import (
+	"reflect"
+	"time"
+)
+
+type TimeFormat int
+
+const (
+	TimeFormatDatetime  TimeFormat = iota // 2006-01-02 15:04:05
+	TimeFormatUnix                        // 秒级时间戳
+	TimeFormatUnixMilli                   // 毫秒级时间戳
+)
+
+// AutoTimeConfig 自动维护创建时间、更新时间的设置
+type AutoTimeConfig struct {
+	CreateColumn string         // 创建时间字段，Insert、Replace 时未设置则自动填充
+	UpdateColumn string         // 更新时间字段，Insert、Replace、Update 时自动填充
+	Location     *time.Location // 时区，默认使用 TimeConfig 的 Location（UTC），与读取时的解析保持一致
+	Format       TimeFormat     // 存储格式，TimeFormatDatetime 时使用 TimeConfig 的 WriteLayout
+	Tables       []string       // 自动添加字段的表，其他表只在数据中带有该字段时填充（创建时间只在值为空时填充）
+}
+
+// SetAutoTime 设置自动填充的时间字段，结构体也可以使用 `db:",autoCreateTime"`、`db:",autoUpdateTime"` 标记字段
+func (db *DB) SetAutoTime(conf AutoTimeConfig) {
+	db.settings.lock.Lock()
+	db.settings.autoTime = conf
+	db.settings.lock.Unlock()
+}
+
+func (settings *dbSettings) getAutoTime() AutoTimeConfig {
+	if settings == nil {
+		return AutoTimeConfig{}
+	}
+	settings.lock.RLock()
+	defer settings.lock.RUnlock()
+	return settings.autoTime
+}
+
+// 按设置的时区和格式生成当前时间，fieldType 为结构体字段类型时按字段类型生成
+func (settings *dbSettings) makeTimeValue(fieldType reflect.Type) interface{} {
+	conf := settings.getAutoTime()
+	timeConf := settings.getTimeConfig()
+	now := timeConf.now()
+	if conf.Location != nil {
+		now = now.In(conf.Location)
+	}
+
+	format := conf.Format
+	if fieldType != nil {
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		switch fieldType.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+			if format == TimeFormatDatetime {
+				format = TimeFormatUnix
+			}
+		case reflect.String:
+			format = TimeFormatDatetime
+		}
+	}
+
+	switch format {
+	case TimeFormatUnix:
+		return now.Unix()
+	case TimeFormatUnixMilli:
+		return now.UnixMilli()
+	default:
+		return now.Format(timeConf.writeLayout())
+	}
+}
+
+func (settings *dbSettings) fillAutoTime(table string, data interface{}, keys []string, vars []string, values []interface{}, isUpdate bool) ([]string, []string, []interface{}) {
+	conf := settings.getAutoTime()
+	createColumn := conf.CreateColumn
+	updateColumn := conf.UpdateColumn
+	// 设置的表和结构体中标记的字段自动添加，其他表只填充数据中已有的字段，避免写入表中不存在的字段
+	createAdd := containsAnyFold(conf.Tables, []string{table})
+	updateAdd := createAdd
+	var createType, updateType reflect.Type
+
+	dataValue := reflect.ValueOf(data)
+	for dataValue.Kind() == reflect.Ptr {
+		dataValue = dataValue.Elem()
+	}
+	if dataValue.Kind() == reflect.Struct {
+		if column, field := findTaggedField(dataValue, "autoCreateTime", settings.getNameMapper()); column != "" {
+			createColumn = column
+			createType = field.Type()
+			createAdd = true
+		}
+		if column, field := findTaggedField(dataValue, "autoUpdateTime", settings.getNameMapper()); column != "" {
+			updateColumn = column
+			updateType = field.Type()
+			updateAdd = true
+		}
+	}
+
+	if createColumn != "" {
+		keyIndex, valueIndex := findKeyIndex(keys, vars, createColumn)
+		if isUpdate {
+			// 更新时不覆盖创建时间
+			if keyIndex >= 0 && valueIndex >= 0 && isZeroValue(values[valueIndex]) {
+				keys, vars, values = removeKey(keys, vars, values, keyIndex, valueIndex)
+			}
+		} else if keyIndex == -1 && createAdd {
+			keys = append(keys, createColumn)
+			vars = append(vars, "?")
+			values = append(values, settings.makeTimeValue(createType))
+		} else if valueIndex >= 0 && isZeroValue(values[valueIndex]) {
+			values[valueIndex] = settings.makeTimeValue(createType)
+		}
+	}
+
+	if updateColumn != "" {
+		keyIndex, valueIndex := findKeyIndex(keys, vars, updateColumn)
+		if keyIndex == -1 && updateAdd {
+			keys = append(keys, updateColumn)
+			vars = append(vars, "?")
+			values = append(values, settings.makeTimeValue(updateType))
+		} else if keyIndex >= 0 && valueIndex >= 0 {
+			values[valueIndex] = settings.makeTimeValue(updateType)
+		}
+	}
+	return keys, vars, values
+}
+
+func isZeroValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
@@ -12,33 +13,44 @@ import (
 	"github.com/ssgo/u"
 )
 
-func basePrepare(db *sql.DB, tx *sql.Tx, requestSql string) *Stmt {
+func basePrepare(pool *dbPool, tx *sql.Tx, requestSql string) *Stmt {
 	var sqlStmt *sql.Stmt
 	var err error
 	if tx != nil {
 		sqlStmt, err = tx.Prepare(requestSql)
-	} else if db != nil {
-		sqlStmt, err = db.Prepare(requestSql)
 	} else {
-		return &Stmt{Error: errors.New("operate on a bad connection")}
+		var db *sql.DB
+		db, err = pool.getWriteConn()
+		if err != nil {
+			return &Stmt{Error: err}
+		}
+		sqlStmt, err = db.Prepare(requestSql)
 	}
 	if err != nil {
 		return &Stmt{Error: err}
 	}
-	return &Stmt{conn: sqlStmt, lastSql: &requestSql}
+	stmt := &Stmt{conn: sqlStmt, lastSql: &requestSql}
+	if tx == nil {
+		pool.addStmt(stmt)
+	}
+	return stmt
 }
 
-func baseExec(db *sql.DB, tx *sql.Tx, requestSql string, args ...interface{}) *ExecResult {
-	args = flatArgs(args)
+func baseExec(pool *dbPool, tx *sql.Tx, settings *dbSettings, requestSql string, args ...interface{}) *ExecResult {
+	args = settings.makeTimeArgs(flatArgs(args))
 	var r sql.Result
 	var err error
 	startTime := time.Now()
 	if tx != nil {
 		r, err = tx.Exec(requestSql, args...)
-	} else if db != nil {
+	} else if use, connErr := pool.acquire(); connErr != nil {
+		return &ExecResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, time.Now()), Error: connErr}
+	} else if db, connErr := pool.getWriteConn(); connErr == nil {
 		r, err = db.Exec(requestSql, args...)
+		use.release()
 	} else {
-		return &ExecResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, time.Now()), Error: errors.New("operate on a bad connection")}
+		use.release()
+		return &ExecResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, time.Now()), Error: connErr}
 	}
 	endTime := time.Now()
 
@@ -75,6 +87,19 @@ func flatArgs(args []interface{}) []interface{} {
 
 	for i, arg := range args {
 		argValue := reflect.ValueOf(arg)
+		if argValue.IsValid() && isTimeType(argValue.Type()) {
+			// 时间由 makeTimeArgs 处理
+			continue
+		}
+		if argValue.IsValid() && isValuerType(argValue.Type()) {
+			// 由驱动调用 Value 转换，Value 定义在指针上时传入指针
+			if _, ok := arg.(driver.Valuer); !ok {
+				ptr := reflect.New(argValue.Type())
+				ptr.Elem().Set(argValue)
+				args[i] = ptr.Interface()
+			}
+			continue
+		}
 		if argValue.Kind() == reflect.Map || argValue.Kind() == reflect.Struct || (argValue.Kind() == reflect.Slice && argValue.Type().Elem().Kind() != reflect.Uint8) {
 			args[i] = u.Json(arg)
 		}
@@ -82,25 +107,37 @@ func flatArgs(args []interface{}) []interface{} {
 	return args
 }
 
-func baseQuery(db *sql.DB, tx *sql.Tx, requestSql string, args ...interface{}) *QueryResult {
-	args = flatArgs(args)
+func baseQuery(pool *dbPool, tx *sql.Tx, settings *dbSettings, requestSql string, args ...interface{}) *QueryResult {
+	args = settings.makeTimeArgs(flatArgs(args))
 
 	var rows *sql.Rows
+	var use *poolUse
 	var err error
 	startTime := time.Now()
 	if tx != nil {
 		rows, err = tx.Query(requestSql, args...)
-	} else if db != nil {
+	} else if use, err = pool.acquire(); err != nil {
+		return &QueryResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, time.Now()), Error: err}
+	} else if db, connErr := pool.getReadConn(); connErr == nil {
 		rows, err = db.Query(requestSql, args...)
+		if err != nil {
+			use.release()
+		}
 	} else {
-		return &QueryResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, time.Now()), Error: errors.New("operate on a bad connection")}
+		use.release()
+		return &QueryResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, time.Now()), Error: connErr}
 	}
 	endTime := time.Now()
 
 	if err != nil {
 		return &QueryResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, endTime), Error: err}
 	}
-	return &QueryResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, endTime), rows: rows}
+	r := &QueryResult{Sql: &requestSql, Args: args, usedTime: log.MakeUesdTime(startTime, endTime), rows: rows, settings: settings}
+	if tx == nil {
+		// 读取完结果或调用 Complete 后才结束请求
+		r.use = use
+	}
+	return r
 }
 
 func quote(quoteTag string, text string) string {
@@ -118,8 +155,9 @@ func quotes(quoteTag string, texts []string) string {
 	return strings.Join(texts, ",")
 }
 
-func makeInsertSql(quoteTag string, table string, data interface{}, useReplace bool) (string, []interface{}) {
-	keys, vars, values := MakeKeysVarsValues(data)
+func makeInsertSql(settings *dbSettings, quoteTag string, table string, data interface{}, opt *UpdateOptions, useReplace bool) (string, []interface{}) {
+	keys, vars, values := makeKeysVarsValues(data, opt, settings)
+	keys, vars, values = settings.fillAutoTime(table, data, keys, vars, values, false)
 	var operation string
 	if useReplace {
 		operation = "replace"
@@ -130,9 +168,77 @@ func makeInsertSql(quoteTag string, table string, data interface{}, useReplace b
 	return requestSql, values
 }
 
-func makeUpdateSql(quoteTag string, table string, data interface{}, wheres string, args ...interface{}) (string, []interface{}) {
+// 多行插入，字段为所有行中出现过的字段，某行缺少的字段使用 NULL，list 为空时返回空的 sql
+func makeInsertManySql(settings *dbSettings, quoteTag string, table string, list interface{}, opt *UpdateOptions, useReplace bool) (string, []interface{}) {
+	listValue := reflect.ValueOf(list)
+	for listValue.Kind() == reflect.Ptr {
+		listValue = listValue.Elem()
+	}
+	if listValue.Kind() != reflect.Slice {
+		return makeInsertSql(settings, quoteTag, table, list, opt, useReplace)
+	}
+	if listValue.Len() == 0 {
+		return "", nil
+	}
+
+	keys := make([]string, 0)
+	keyIndexes := make(map[string]int)
+	rows := make([]map[string]string, 0, listValue.Len())
+	rowValues := make([]map[string]interface{}, 0, listValue.Len())
+	for i := 0; i < listValue.Len(); i++ {
+		data := listValue.Index(i).Interface()
+		rowKeys, rowVars, values := makeKeysVarsValues(data, opt, settings)
+		rowKeys, rowVars, values = settings.fillAutoTime(table, data, rowKeys, rowVars, values, false)
+		row := make(map[string]string)
+		rowValue := make(map[string]interface{})
+		valueIndex := 0
+		for j, k := range rowKeys {
+			if _, ok := keyIndexes[k]; !ok {
+				keyIndexes[k] = len(keys)
+				keys = append(keys, k)
+			}
+			row[k] = rowVars[j]
+			if rowVars[j] == "?" {
+				rowValue[k] = values[valueIndex]
+				valueIndex++
+			}
+		}
+		rows = append(rows, row)
+		rowValues = append(rowValues, rowValue)
+	}
+
+	values := make([]interface{}, 0)
+	varsList := make([]string, len(rows))
+	for i, row := range rows {
+		vars := make([]string, len(keys))
+		for j, k := range keys {
+			if v, ok := row[k]; ok {
+				vars[j] = v
+				if v == "?" {
+					values = append(values, rowValues[i][k])
+				}
+			} else {
+				vars[j] = "NULL"
+			}
+		}
+		varsList[i] = "(" + strings.Join(vars, ",") + ")"
+	}
+
+	operation := "insert"
+	if useReplace {
+		operation = "replace"
+	}
+	requestSql := fmt.Sprintf("%s into %s (%s) values %s", operation, quote(quoteTag, table), quotes(quoteTag, keys), strings.Join(varsList, ","))
+	return requestSql, values
+}
+
+func makeUpdateSql(settings *dbSettings, quoteTag string, table string, data interface{}, opt *UpdateOptions, wheres string, args ...interface{}) (string, []interface{}) {
 	args = flatArgs(args)
-	keys, vars, values := MakeKeysVarsValues(data)
+	keys, vars, values := makeKeysVarsValues(data, opt, settings)
+	if len(keys) == 0 {
+		return "", nil
+	}
+	keys, vars, values = settings.fillAutoTime(table, data, keys, vars, values, true)
 	for i, k := range keys {
 		keys[i] = fmt.Sprintf("%s=%s", quote(quoteTag, k), vars[i])
 	}
@@ -147,35 +253,78 @@ func makeUpdateSql(quoteTag string, table string, data interface{}, wheres strin
 }
 
 func (db *DB) MakeInsertSql(table string, data interface{}, useReplace bool) (string, []interface{}) {
-	return makeInsertSql(db.QuoteTag, table, data, useReplace)
+	return makeInsertSql(db.settings, db.QuoteTag, table, data, db.updateOptions, useReplace)
 }
 
+// 没有需要更新的字段时返回空字符串
 func (db *DB) MakeUpdateSql(table string, data interface{}, wheres string, args ...interface{}) (string, []interface{}) {
-	return makeUpdateSql(db.QuoteTag, table, data, wheres, args...)
+	return makeUpdateSql(db.settings, db.QuoteTag, table, data, db.updateOptions, wheres, args...)
 }
 
 func (tx *Tx) MakeInsertSql(table string, data interface{}, useReplace bool) (string, []interface{}) {
-	return makeInsertSql(tx.QuoteTag, table, data, useReplace)
+	return makeInsertSql(tx.settings, tx.QuoteTag, table, data, tx.updateOptions, useReplace)
 }
 
 func (tx *Tx) MakeUpdateSql(table string, data interface{}, wheres string, args ...interface{}) (string, []interface{}) {
-	return makeUpdateSql(tx.QuoteTag, table, data, wheres, args...)
+	return makeUpdateSql(tx.settings, tx.QuoteTag, table, data, tx.updateOptions, wheres, args...)
 }
 
-func getFlatFields(fields map[string]reflect.Value, fieldKeys *[]string, value reflect.Value) {
+// ErrNoFieldsToUpdate Update 时所有字段都被过滤掉
+var ErrNoFieldsToUpdate = errors.New("no fields to update")
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+func isValuerType(t reflect.Type) bool {
+	return t.Implements(valuerType) || reflect.PointerTo(t).Implements(valuerType)
+}
+
+func getFlatFields(fields map[string]reflect.Value, fieldKeys *[]string, tags map[string]string, value reflect.Value) {
 	valueType := value.Type()
 	for i := 0; i < value.NumField(); i++ {
 		v := value.Field(i)
-		if valueType.Field(i).Anonymous {
-			getFlatFields(fields, fieldKeys, v)
+		if valueType.Field(i).Anonymous && v.Kind() == reflect.Struct && !isValuerType(v.Type()) && !isJSONTagged(valueType.Field(i)) {
+			getFlatFields(fields, fieldKeys, tags, v)
 		} else {
 			*fieldKeys = append(*fieldKeys, valueType.Field(i).Name)
 			fields[valueType.Field(i).Name] = v
+			tags[valueType.Field(i).Name] = valueType.Field(i).Tag.Get("db")
 		}
 	}
 }
 
+// 查找字段在 keys 中的位置以及对应值在 values 中的位置，不存在时返回 -1
+func findKeyIndex(keys []string, vars []string, key string) (int, int) {
+	valueIndex := 0
+	for i, k := range keys {
+		if strings.EqualFold(k, key) {
+			if vars[i] != "?" {
+				return i, -1
+			}
+			return i, valueIndex
+		}
+		if vars[i] == "?" {
+			valueIndex++
+		}
+	}
+	return -1, -1
+}
+
+func removeKey(keys []string, vars []string, values []interface{}, keyIndex, valueIndex int) ([]string, []string, []interface{}) {
+	keys = append(keys[:keyIndex], keys[keyIndex+1:]...)
+	vars = append(vars[:keyIndex], vars[keyIndex+1:]...)
+	if valueIndex >= 0 {
+		values = append(values[:valueIndex], values[valueIndex+1:]...)
+	}
+	return keys, vars, values
+}
+
 func MakeKeysVarsValues(data interface{}) ([]string, []string, []interface{}) {
+	return makeKeysVarsValues(data, nil, nil)
+}
+
+// 结构体字段名按 settings 中的 mapper 转换为字段名，Map 的 key 直接作为字段名，关联字段不写入
+func makeKeysVarsValues(data interface{}, opt *UpdateOptions, settings *dbSettings) ([]string, []string, []interface{}) {
+	mapper := settings.getNameMapper()
 	keys := make([]string, 0)
 	vars := make([]string, 0)
 	values := make([]interface{}, 0)
@@ -191,18 +340,29 @@ func MakeKeysVarsValues(data interface{}) ([]string, []string, []interface{}) {
 		// 按结构处理数据
 		fields := make(map[string]reflect.Value)
 		fieldKeys := make([]string, 0)
-		getFlatFields(fields, &fieldKeys, dataValue)
+		tags := make(map[string]string)
+		getFlatFields(fields, &fieldKeys, tags, dataValue)
 		//for i := 0; i < dataType.NumField(); i++ {
 		for _, k := range fieldKeys {
 			if k[0] >= 'a' && k[0] <= 'z' {
 				continue
 			}
 			v := fields[k]
+			column := tagColumnName(tags[k], k, mapper)
+			if opt.skip(v, hasTagOption(tags[k], "omitempty"), k, column) || isRelationTag(tags[k]) || settings.hasRelation(dataType, k) {
+				continue
+			}
+			if hasTagOption(tags[k], "json") {
+				keys = append(keys, column)
+				vars = append(vars, "?")
+				values = append(values, makeJSONValue(v))
+				continue
+			}
 			if v.Kind() == reflect.Interface {
 				v = v.Elem()
 			}
-			keys = append(keys, k)
-			if v.Kind() == reflect.String && v.Len() > 0 && []byte(v.String())[0] == ':' {
+			keys = append(keys, column)
+			if v.Kind() == reflect.String && !isValuerType(v.Type()) && v.Len() > 0 && []byte(v.String())[0] == ':' {
 				vars = append(vars, string([]byte(v.String())[1:]))
 			} else {
 				vars = append(vars, "?")
@@ -221,8 +381,11 @@ func MakeKeysVarsValues(data interface{}) ([]string, []string, []interface{}) {
 			if v.Kind() == reflect.Interface {
 				v = v.Elem()
 			}
+			if opt.skip(v, false, k.String()) {
+				continue
+			}
 			keys = append(keys, k.String())
-			if v.Kind() == reflect.String && v.Len() > 0 && []byte(v.String())[0] == ':' {
+			if v.Kind() == reflect.String && !isValuerType(v.Type()) && v.Len() > 0 && []byte(v.String())[0] == ':' {
 				vars = append(vars, string([]byte(v.String())[1:]))
 			} else {
 				vars = append(vars, "?")
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrClosed = errors.New("db is closed")
+
+// 记录通过 Prepare 创建的 Stmt，关闭连接池时一并关闭
+func (pool *dbPool) addStmt(stmt *Stmt) {
+	if pool == nil {
+		return
+	}
+	pool.lock.Lock()
+	if pool.stmts == nil {
+		pool.stmts = make(map[*Stmt]bool)
+	}
+	pool.stmts[stmt] = true
+	pool.lock.Unlock()
+	stmt.pool = pool
+}
+
+func (pool *dbPool) removeStmt(stmt *Stmt) {
+	if pool == nil {
+		return
+	}
+	pool.lock.Lock()
+	delete(pool.stmts, stmt)
+	pool.lock.Unlock()
+}
+
+// 正在执行的请求，conns 为开始时使用的连接组的计数，重新加载配置后旧连接组的请求都结束才关闭
+type poolUse struct {
+	pool  *dbPool
+	conns *atomic.Int64
+}
+
+// 计入正在执行的请求，先计数再检查是否已关闭，避免 wait 遗漏同时开始的请求
+// 需要在获得连接之前调用，重新加载配置时替换连接和计数在同一个锁中，保证使用旧连接的请求计入旧的计数
+func (pool *dbPool) acquire() (*poolUse, error) {
+	if pool == nil {
+		return nil, nil
+	}
+	pool.lock.RLock()
+	conns := pool.conns
+	pool.lock.RUnlock()
+	pool.active.Add(1)
+	conns.Add(1)
+	use := &poolUse{pool: pool, conns: conns}
+	if pool.closed.Load() {
+		use.release()
+		return nil, ErrClosed
+	}
+	return use, nil
+}
+
+func (use *poolUse) release() {
+	if use != nil {
+		use.pool.active.Add(-1)
+		use.conns.Add(-1)
+	}
+}
+
+// 等待正在执行的请求和事务结束，超过 ctx 的期限后返回错误
+func (pool *dbPool) wait(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for pool.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// 关闭主节点、只读节点以及所有 Stmt，之后的调用返回 ErrClosed
+func (pool *dbPool) close() error {
+	if pool == nil {
+		return nil
+	}
+	pool.closed.Store(true)
+	pool.lock.Lock()
+	conn := pool.conn
+	readonlyConnections := pool.readonlyConnections
+	stmts := pool.stmts
+	pool.stmts = nil
+	pool.lock.Unlock()
+
+	errs := make([]error, 0)
+	for stmt := range stmts {
+		if stmt.conn != nil {
+			if err := stmt.conn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if conn != nil {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, readonlyConn := range readonlyConnections {
+		if err := readonlyConn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	pool.runCleanup()
+	return errors.Join(errs...)
+}
+
+func (pool *dbPool) runCleanup() {
+	pool.lock.Lock()
+	cleanup := pool.cleanup
+	pool.cleanup = nil
+	pool.lock.Unlock()
+	if cleanup != nil {
+		cleanup()
+	}
+}
+
+// 不再接受新的请求，等待正在执行的请求和事务结束后（最长 timeout）关闭连接池
+func (db *DB) destroyAfterDrain(timeout time.Duration) {
+	dbInstancesLock.Lock()
+	if instance := dbInstances[db.name]; instance != nil && instance.pool == db.pool {
+		delete(dbInstances, db.name)
+	}
+	dbInstancesLock.Unlock()
+	db.pool.closed.Store(true)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := db.pool.wait(ctx); err != nil {
+			db.logger.LogError(err.Error())
+		}
+		if err := db.pool.close(); err != nil {
+			db.logger.LogError(err.Error())
+		}
+	}()
+}
+
+// 关闭所有数据库实例，等待正在执行的请求和事务结束（最长到 ctx 的期限）
+func CloseAll(ctx context.Context) error {
+	dbInstancesLock.Lock()
+	dbs := make([]*DB, 0, len(dbInstances))
+	for _, db := range dbInstances {
+		dbs = append(dbs, db)
+	}
+	dbInstances = make(map[string]*DB)
+	dbInstancesLock.Unlock()
+
+	// 先拒绝新的请求，再等待已有的请求结束
+	for _, db := range dbs {
+		db.pool.closed.Store(true)
+	}
+	errs := make([]error, 0)
+	for _, db := range dbs {
+		if err := db.pool.wait(ctx); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+	for _, db := range dbs {
+		if err := db.pool.close(); err != nil {
+			db.logger.LogError(err.Error())
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
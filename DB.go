@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ssgo/config"
@@ -29,15 +32,23 @@ type dbInfo struct {
 	MaxOpens      int
 	MaxIdles      int
 	MaxLifeTime   int
+	MaxIdleTime   int
+	MinIdles      int
+	InitSqls      []string
+	ReadonlyPools map[string]*dbPoolSettings
 	LogSlow       config.Duration
+	urlSSL        *dbSSL
+	tlsArgs       string
 	logger        *log.Logger
 }
 
 type dbSSL struct {
-	Ca       string
-	Cert     string
-	Key      string
-	Insecure bool
+	Ca         string
+	Cert       string
+	Key        string
+	Insecure   bool
+	ServerName string
+	MinVersion string
 }
 
 var sqlite3PwdMatcher = regexp.MustCompile("x'\\w+'")
@@ -128,6 +139,9 @@ func (dbInfo *dbInfo) ConfigureBy(setting string) {
 	dbInfo.MaxIdles = u.Int(q.Get("maxIdles"))
 	dbInfo.MaxLifeTime = u.Int(q.Get("maxLifeTime"))
 	dbInfo.MaxOpens = u.Int(q.Get("maxOpens"))
+	dbInfo.MaxIdleTime = u.Int(q.Get("maxIdleTime"))
+	dbInfo.MinIdles = u.Int(q.Get("minIdles"))
+	dbInfo.InitSqls = q["initSql"]
 	dbInfo.LogSlow = config.Duration(u.Duration(q.Get("logSlow")))
 	dbInfo.SSL = q.Get("tls")
 
@@ -136,31 +150,119 @@ func (dbInfo *dbInfo) ConfigureBy(setting string) {
 	sslCert := q.Get("sslCert")
 	sslKey := q.Get("sslKey")
 	sslSkipVerify := u.Bool(q.Get("sslSkipVerify"))
-	if sslCa != "" && sslCert != "" && sslKey != "" {
-		sslName := u.UniqueId()
-		dbInfo.SSL = sslName
-		RegisterSSL(sslName, u.DecryptAes(sslCa, settedKey, settedIv), u.DecryptAes(sslCert, settedKey, settedIv), u.DecryptAes(sslKey, settedKey, settedIv), sslSkipVerify)
+	if sslCa != "" || (sslCert != "" && sslKey != "") {
+		// 在创建连接池时解析并注册
+		dbInfo.SSL = u.UniqueId()
+		dbInfo.urlSSL = &dbSSL{Ca: sslCa, Cert: sslCert, Key: sslKey, Insecure: sslSkipVerify, ServerName: q.Get("sslServerName"), MinVersion: q.Get("sslMinVersion")}
+	} else {
+		dbInfo.urlSSL = nil
 	}
 
 	args := make([]string, 0)
 	for k := range q {
-		if k != "maxIdles" && k != "maxLifeTime" && k != "maxOpens" && k != "logSlow" && k != "tls" {
+		if k != "maxIdles" && k != "maxLifeTime" && k != "maxOpens" && k != "maxIdleTime" && k != "minIdles" && k != "initSql" && k != "logSlow" && k != "tls" && k != "sslCA" && k != "sslCert" && k != "sslKey" && k != "sslSkipVerify" && k != "sslServerName" && k != "sslMinVersion" {
 			args = append(args, k+"="+q.Get(k))
 		}
 	}
+	sort.Strings(args)
 	if len(args) > 0 {
 		dbInfo.Args = strings.Join(args, "&")
 	}
 }
 
 type DB struct {
-	name                string
+	name           string
+	pool           *dbPool
+	Config         *dbInfo
+	logger         *dbLogger
+	Error          error
+	QuoteTag       string
+	settings       *dbSettings
+	softDeleteMode int
+	updateOptions  *UpdateOptions
+}
+
+// 连接池，重新加载配置时替换其中的连接，已经复制出去的 DB 同时使用新的连接
+type dbPool struct {
+	lock                sync.RWMutex
 	conn                *sql.DB
 	readonlyConnections []*sql.DB
-	Config              *dbInfo
-	logger              *dbLogger
-	Error               error
-	QuoteTag            string
+	readonlyHosts       []string
+	config              *dbInfo
+	rawConfig           dbInfo
+	stats               dbStats
+	active              atomic.Int64
+	conns               *atomic.Int64 // 当前连接组正在执行的请求，重新加载配置时替换
+	closed              atomic.Bool
+	stmts               map[*Stmt]bool
+	cleanup             func() // 关闭连接池时删除 tls 使用的临时文件
+}
+
+func (pool *dbPool) get() (*sql.DB, []*sql.DB, *dbInfo) {
+	if pool == nil {
+		return nil, nil, &dbInfo{}
+	}
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	// 重新加载配置时会修改 config 的内容，返回副本
+	conf := *pool.config
+	return pool.conn, pool.readonlyConnections, &conf
+}
+
+func (pool *dbPool) getConn() *sql.DB {
+	conn, _, _ := pool.get()
+	return conn
+}
+
+// 获得主节点连接池
+func (pool *dbPool) getWriteConn() (*sql.DB, error) {
+	if pool != nil && pool.closed.Load() {
+		return nil, ErrClosed
+	}
+	conn := pool.getConn()
+	if conn == nil {
+		return nil, errors.New("operate on a bad connection")
+	}
+	return conn, nil
+}
+
+// 获得用于查询的连接池，有只读节点时随机选择一个只读节点
+func (pool *dbPool) getReadConn() (*sql.DB, error) {
+	if pool != nil && pool.closed.Load() {
+		return nil, ErrClosed
+	}
+	conn, readonlyConnections, _ := pool.get()
+	if readonlyConnections != nil {
+		connNum := len(readonlyConnections)
+		if connNum == 1 {
+			conn = readonlyConnections[0]
+		} else {
+			p := u.GlobalRand1.Intn(connNum)
+			conn = readonlyConnections[p]
+		}
+	}
+	if conn == nil {
+		return nil, errors.New("operate on a bad connection")
+	}
+	return conn, nil
+}
+
+func (pool *dbPool) getConfig() *dbInfo {
+	_, _, conf := pool.get()
+	return conf
+}
+
+type dbSettings struct {
+	lock        sync.RWMutex
+	softDeletes map[string]string
+	autoTime    AutoTimeConfig
+	timeConfig  TimeConfig
+	nameMapper  *NameMapper
+	relations   map[reflect.Type]map[string]Relation
+}
+
+func newDBSettings() *dbSettings {
+	return &dbSettings{softDeletes: make(map[string]string)}
 }
 
 // var settedKey = []byte("vpL54DlR2KG{JSAaAX7Tu;*#&DnG`M0o")
@@ -169,38 +271,121 @@ var settedKey = []byte("?GQ$0K0GgLdO=f+~L68PLm$uhKr4'=tV")
 var settedIv = []byte("VFs7@sK61cj^f?HZ")
 var keysSetted = false
 
+// 设置没有版本前缀时使用的密钥，只能设置一次，需要轮换密钥时使用 Keyring
 func SetEncryptKeys(key, iv []byte) {
 	if !keysSetted {
 		settedKey = key
 		settedIv = iv
 		keysSetted = true
+	} else {
+		log.DefaultLogger.Warning("encrypt keys already setted, use Keyring to rotate keys")
 	}
 }
 
 type dbLogger struct {
-	config *dbInfo
+	pool   *dbPool
 	logger *log.Logger
 }
 
 func (dl *dbLogger) LogError(error string) {
-	dl.logger.DBError(error, dl.config.Type, dl.config.Dsn(), "", nil, 0)
+	dl.countError()
+	conf := dl.pool.getConfig()
+	dl.logger.DBError(error, conf.Type, conf.Dsn(), "", nil, 0)
 }
 
 func (dl *dbLogger) LogQuery(query string, args []interface{}, usedTime float32) {
-	dl.logger.DB(dl.config.Type, dl.config.Dsn(), query, args, usedTime)
+	dl.countSlowQuery()
+	conf := dl.pool.getConfig()
+	dl.logger.DB(conf.Type, conf.Dsn(), query, args, usedTime)
 }
 
 func (dl *dbLogger) LogQueryError(error string, query string, args []interface{}, usedTime float32) {
-	dl.logger.DBError(error, dl.config.Type, dl.config.Dsn(), query, args, usedTime)
+	dl.countError()
+	conf := dl.pool.getConfig()
+	dl.logger.DBError(error, conf.Type, conf.Dsn(), query, args, usedTime)
 }
 
 var dbConfigs = make(map[string]*dbInfo)
 var dbConfigsLock = sync.RWMutex{}
 var dbSSLs = make(map[string]*dbSSL)
+var dbSSLErrors = make(map[string]error)
 var dbInstances = make(map[string]*DB)
 var dbInstancesLock = sync.RWMutex{}
 var once sync.Once
 
+func loadDBConfigs(logger *log.Logger) map[string]*dbInfo {
+	configs := make(map[string]*dbInfo)
+	dbConfigs1 := make(map[string]*dbInfo)
+	if errs := config.LoadConfig("db", &dbConfigs1); errs == nil {
+		for k, v := range dbConfigs1 {
+			if v.Host != "" {
+				configs[k] = v
+			}
+		}
+	} else {
+		for _, err := range errs {
+			logger.Error(err.Error())
+		}
+	}
+	dbConfigs2 := make(map[string]string)
+	if errs := config.LoadConfig("db", &dbConfigs2); errs == nil {
+		for k, v := range dbConfigs2 {
+			if strings.Contains(v, "://") {
+				v2 := new(dbInfo)
+				v2.logger = logger
+				v2.ConfigureBy(v)
+				if v2.Host != "" {
+					configs[k] = v2
+				}
+			} else {
+				v2 := configs[v]
+				if v2 != nil && v2.Host != "" {
+					configs[k] = v2
+				}
+			}
+		}
+	} else {
+		for _, err := range errs {
+			logger.Error(err.Error())
+		}
+	}
+	return configs
+}
+
+func loadDBSSLs() {
+	config.LoadConfig("dbssl", &dbSSLs)
+	errs := make(map[string]error)
+	for sslName, sslInfo := range dbSSLs {
+		if err := registerDBSSL(sslName, sslInfo); err != nil {
+			log.DefaultLogger.Error(err.Error(), "ssl", sslName)
+			errs[sslName] = err
+		}
+	}
+	dbSSLErrors = errs
+}
+
+func resolveSSLSecret(value string) (string, error) {
+	resolved, _, err := resolveSecret(value, getSSLKeyring())
+	return resolved, err
+}
+
+// 解析证书配置（支持 SecretProvider）并注册
+func registerDBSSL(name string, sslInfo *dbSSL) error {
+	ca, err := resolveSSLSecret(sslInfo.Ca)
+	if err != nil {
+		return fmt.Errorf("sslCA: %w", err)
+	}
+	cert, err := resolveSSLSecret(sslInfo.Cert)
+	if err != nil {
+		return fmt.Errorf("sslCert: %w", err)
+	}
+	key, err := resolveSSLSecret(sslInfo.Key)
+	if err != nil {
+		return fmt.Errorf("sslKey: %w", err)
+	}
+	return RegisterSSLConfig(name, &SSLConfig{CA: ca, Cert: cert, Key: key, Insecure: sslInfo.Insecure, ServerName: sslInfo.ServerName, MinVersion: sslInfo.MinVersion})
+}
+
 func GetDB(name string, logger *log.Logger) *DB {
 	if logger == nil {
 		logger = log.DefaultLogger
@@ -224,46 +409,12 @@ func GetDB(name string, logger *log.Logger) *DB {
 		dbConfigsLock.RUnlock()
 		if n == 0 {
 			once.Do(func() {
-				dbConfigs1 := make(map[string]*dbInfo)
-				if errs := config.LoadConfig("db", &dbConfigs1); errs == nil {
-					for k, v := range dbConfigs1 {
-						if v.Host != "" {
-							dbConfigsLock.Lock()
-							dbConfigs[k] = v
-							dbConfigsLock.Unlock()
-						}
-					}
-				} else {
-					for _, err := range errs {
-						logger.Error(err.Error())
-					}
-				}
-				dbConfigs2 := make(map[string]string)
-				if errs := config.LoadConfig("db", &dbConfigs2); errs == nil {
-					for k, v := range dbConfigs2 {
-						if strings.Contains(v, "://") {
-							v2 := new(dbInfo)
-							v2.ConfigureBy(v)
-							if v2.Host != "" {
-								v2.logger = logger
-								dbConfigsLock.Lock()
-								dbConfigs[k] = v2
-								dbConfigsLock.Unlock()
-							}
-						} else {
-							dbConfigsLock.Lock()
-							v2 := dbConfigs[v]
-							if v2 != nil && v2.Host != "" {
-								dbConfigs[k] = v2
-							}
-							dbConfigsLock.Unlock()
-						}
-					}
-				} else {
-					for _, err := range errs {
-						logger.Error(err.Error())
-					}
+				configs := loadDBConfigs(logger)
+				dbConfigsLock.Lock()
+				for k, v := range configs {
+					dbConfigs[k] = v
 				}
+				dbConfigsLock.Unlock()
 			})
 		}
 		dbConfigsLock.RLock()
@@ -296,27 +447,48 @@ func GetDB(name string, logger *log.Logger) *DB {
 	// 	conf.DB = "test"
 	// }
 
-	if conf.SSL != "" && len(dbSSLs) == 0 {
-		config.LoadConfig("dbssl", &dbSSLs)
-		for sslName, sslInfo := range dbSSLs {
-			decryptedCa := u.DecryptAes(sslInfo.Ca, settedKey, settedIv)
-			decryptedCert := u.DecryptAes(sslInfo.Cert, settedKey, settedIv)
-			decryptedKey := u.DecryptAes(sslInfo.Key, settedKey, settedIv)
-			if decryptedCa == "" {
-				decryptedCa = sslInfo.Ca
-			}
-			if decryptedCert == "" {
-				decryptedCert = sslInfo.Cert
-			}
-			if decryptedKey == "" {
-				decryptedKey = sslInfo.Key
-			}
-			RegisterSSL(sslName, decryptedCa, decryptedCert, decryptedKey, sslInfo.Insecure)
-		}
+	pool, err := openPool(conf, logger)
+	if err != nil {
+		logger.DBError(err.Error(), pool.config.Type, pool.config.Dsn(), "", nil, 0)
+		errDB := &DB{QuoteTag: "\"", pool: pool, settings: newDBSettings()}
+		errDB = errDB.CopyByLogger(logger)
+		errDB.Error = err
+		return errDB
 	}
 
-	if conf.SSL != "" && dbSSLs[conf.SSL] == nil {
-		logger.Error("dbssl config lost")
+	db := new(DB)
+	db.settings = newDBSettings()
+	db.QuoteTag = u.StringIf(conf.Type == "mysql", "`", "\"")
+	// db.QuoteTag = u.StringIf(conf.Type == "mysql" || strings.HasPrefix(conf.Type, "sqlite"), "`", "\"")
+	db.name = name
+	db.pool = pool
+	db.Error = nil
+	db.Config = pool.config
+	dbInstancesLock.Lock()
+	dbInstances[name] = db
+	dbInstancesLock.Unlock()
+	return db.CopyByLogger(logger)
+}
+
+// 按配置创建连接池，不修改传入的配置
+func openPool(rawConf *dbInfo, logger *log.Logger) (*dbPool, error) {
+	conf := new(dbInfo)
+	*conf = *rawConf
+	pool := &dbPool{config: conf, rawConfig: *rawConf, conns: new(atomic.Int64)}
+
+	if conf.urlSSL != nil {
+		if err := registerDBSSL(conf.SSL, conf.urlSSL); err != nil {
+			return pool, err
+		}
+	} else if conf.SSL != "" {
+		if len(dbSSLs) == 0 {
+			loadDBSSLs()
+		}
+		if dbSSLs[conf.SSL] == nil {
+			logger.Error("dbssl config lost")
+		} else if err := dbSSLErrors[conf.SSL]; err != nil {
+			return pool, err
+		}
 	}
 
 	if strings.ContainsRune(conf.Host, ',') {
@@ -329,11 +501,15 @@ func GetDB(name string, logger *log.Logger) *DB {
 	}
 
 	if conf.Password != "" {
-		conf.pwd = u.DecryptAes(conf.Password, settedKey, settedIv)
-		if conf.pwd == "" {
+		pwd, resolved, err := resolveSecret(conf.Password, getKeyring())
+		if err != nil {
+			conf.Password = ""
+			return pool, fmt.Errorf("password: %w", err)
+		}
+		if !resolved {
 			log.DefaultLogger.Warning("password is invalid")
-			conf.pwd = conf.Password
 		}
+		conf.pwd = pwd
 	} else {
 		// sqlite or default config for mysql don't warning empty password
 		if !isFileDB(conf.Type) && conf.Host != "127.0.0.1:3306" && conf.User == "root" {
@@ -359,52 +535,46 @@ func GetDB(name string, logger *log.Logger) *DB {
 	//	return &DB{conn: nil, Error: err}
 	//}
 	//conn, err := getPool(conf.Type, conf.Host, conf.User, decryptedPassword, conf.DB)
+	if conf.SSL != "" {
+		tlsArgs, cleanup, err := makeTLSArgs(conf.Type, conf.SSL)
+		if err != nil {
+			return pool, err
+		}
+		conf.tlsArgs = tlsArgs
+		pool.cleanup = cleanup
+	}
 	conn, err := getPool(conf)
 	if err != nil {
-		logger.DBError(err.Error(), conf.Type, conf.Dsn(), "", nil, 0)
-		return &DB{conn: nil, QuoteTag: "\"", Error: err}
+		pool.runCleanup()
+		return pool, err
 	}
-
-	db := new(DB)
-	db.QuoteTag = u.StringIf(conf.Type == "mysql", "`", "\"")
-	// db.QuoteTag = u.StringIf(conf.Type == "mysql" || strings.HasPrefix(conf.Type, "sqlite"), "`", "\"")
-	db.name = name
-	db.conn = conn
+	pool.conn = conn
+	applyPoolSettings(conn, conf, "")
 
 	// 创建只读连接池
 	if conf.ReadonlyHosts != nil {
 		readonlyConnections := make([]*sql.DB, 0)
+		readonlyHosts := make([]string, 0)
 		for _, host := range conf.ReadonlyHosts {
 			conn, err := getPoolForHost(conf, host)
 			if err != nil {
 				logger.DBError(err.Error(), conf.Type, conf.Dsn(), "", nil, 0)
 			} else {
+				applyPoolSettings(conn, conf, host)
 				readonlyConnections = append(readonlyConnections, conn)
+				readonlyHosts = append(readonlyHosts, host)
 			}
 		}
 		if len(readonlyConnections) > 0 {
-			db.readonlyConnections = readonlyConnections
+			pool.readonlyConnections = readonlyConnections
+			pool.readonlyHosts = readonlyHosts
 		}
 	}
 
-	db.Error = nil
-	db.Config = conf
-	if conf.MaxIdles > 0 {
-		conn.SetMaxIdleConns(conf.MaxIdles)
-	}
-	if conf.MaxOpens > 0 {
-		conn.SetMaxOpenConns(conf.MaxOpens)
-	}
-	if conf.MaxLifeTime > 0 {
-		conn.SetConnMaxLifetime(time.Second * time.Duration(conf.MaxLifeTime))
-	}
 	if conf.LogSlow == 0 {
 		conf.LogSlow = config.Duration(1000 * time.Millisecond)
 	}
-	dbInstancesLock.Lock()
-	dbInstances[name] = db
-	dbInstancesLock.Unlock()
-	return db.CopyByLogger(logger)
+	return pool, nil
 }
 
 // func getPool(typ, host, user, pwd, db string) (*sql.DB, error) {
@@ -413,53 +583,71 @@ func getPool(conf *dbInfo) (*sql.DB, error) {
 }
 
 func getPoolForHost(conf *dbInfo, host string) (*sql.DB, error) {
-	connectType := "tcp"
 	if host == "" {
 		host = conf.Host
 	}
-	if []byte(host)[0] == '/' {
-		connectType = "unix"
+	connector, err := makeConnector(conf.Type, makeDSN(conf, host), conf.InitSqls)
+	if err != nil {
+		return nil, err
 	}
+	return sql.OpenDB(connector), nil
+}
 
-	dsn := ""
+// 按数据库类型生成连接字符串，postgres 使用 URL 格式，其他使用 mysql 的格式
+func makeDSN(conf *dbInfo, host string) string {
 	args := make([]string, 0)
-	if conf.SSL != "" {
-		args = append(args, "tls="+conf.SSL)
+	if conf.tlsArgs != "" {
+		args = append(args, conf.tlsArgs)
 	}
 	if conf.Args != "" {
 		args = append(args, conf.Args)
 	}
+
+	if isFileDB(conf.Type) {
+		if len(args) > 0 {
+			return host + "?" + strings.Join(args, "&")
+		}
+		return host
+	}
+
+	if isPostgres(conf.Type) {
+		dsnUrl := &url.URL{Scheme: "postgres", Host: host, Path: "/" + conf.DB}
+		if conf.User != "" {
+			dsnUrl.User = url.UserPassword(conf.User, conf.pwd)
+		}
+		if host[0] == '/' {
+			// unix socket 的目录通过 host 参数指定
+			dsnUrl.Host = ""
+			args = append(args, "host="+url.QueryEscape(host))
+		}
+		dsnUrl.RawQuery = strings.Join(args, "&")
+		return dsnUrl.String()
+	}
+
+	connectType := "tcp"
+	if host[0] == '/' {
+		connectType = "unix"
+	}
 	argsStr := ""
 	if len(args) > 0 {
 		argsStr = "?" + strings.Join(args, "&")
 	}
-	if isFileDB(conf.Type) {
-		dsn = host + argsStr
-		//fmt.Println("   >>>>>>>>", dsn)
-		//if conf.pwd != "" {
-		//	dsn += fmt.Sprint("?_auth&_auth_user=", conf.User, "&_auth_pass=", conf.pwd, "&_auth_crypt=sha512")
-		//}
-	} else {
-		//sslStr := ""
-		//if conf.SSL != "" {
-		//	sslStr = "?tls=" + conf.SSL
-		//}
-		dsn = fmt.Sprintf("%s:%s@%s(%s)/%s"+argsStr, conf.User, conf.pwd, connectType, host, conf.DB)
-	}
-	return sql.Open(conf.Type, dsn)
+	return fmt.Sprintf("%s:%s@%s(%s)/%s"+argsStr, conf.User, conf.pwd, connectType, host, conf.DB)
 }
 
 func (db *DB) CopyByLogger(logger *log.Logger) *DB {
 	newDB := new(DB)
 	newDB.QuoteTag = db.QuoteTag
 	newDB.name = db.name
-	newDB.conn = db.conn
-	newDB.readonlyConnections = db.readonlyConnections
-	newDB.Config = db.Config
+	newDB.pool = db.pool
+	newDB.Config = db.pool.config
+	newDB.settings = db.settings
+	newDB.softDeleteMode = db.softDeleteMode
+	newDB.updateOptions = db.updateOptions
 	if logger == nil {
 		logger = log.DefaultLogger
 	}
-	newDB.logger = &dbLogger{logger: logger, config: db.Config}
+	newDB.logger = &dbLogger{logger: logger, pool: db.pool}
 	return newDB
 }
 
@@ -472,10 +660,10 @@ func (db *DB) GetLogger() *log.Logger {
 }
 
 func (db *DB) Destroy() error {
-	if db.conn == nil {
+	if db.pool.getConn() == nil {
 		return errors.New("operate on a bad connection")
 	}
-	err := db.conn.Close()
+	err := db.pool.close()
 	//logError(err, nil, nil)
 	if err != nil {
 		db.logger.LogError(err.Error())
@@ -487,15 +675,13 @@ func (db *DB) Destroy() error {
 }
 
 func (db *DB) GetOriginDB() *sql.DB {
-	if db.conn == nil {
-		return nil
-	}
-	return db.conn
+	return db.pool.getConn()
 }
 
 func (db *DB) Prepare(requestSql string) *Stmt {
-	stmt := basePrepare(db.conn, nil, requestSql)
+	stmt := basePrepare(db.pool, nil, requestSql)
 	stmt.logger = db.logger
+	stmt.settings = db.settings
 	if stmt.Error != nil {
 		db.logger.LogError(stmt.Error.Error())
 	}
@@ -511,24 +697,34 @@ func (db *DB) Quotes(texts []string) string {
 }
 
 func (db *DB) Begin() *Tx {
-	if db.conn == nil {
-		return &Tx{QuoteTag: db.QuoteTag, logSlow: db.Config.LogSlow.TimeDuration(), Error: errors.New("operate on a bad connection"), logger: db.logger}
+	conf := db.pool.getConfig()
+	use, err := db.pool.acquire()
+	if err != nil {
+		return &Tx{QuoteTag: db.QuoteTag, logSlow: conf.LogSlow.TimeDuration(), Error: err, logger: db.logger, settings: db.settings, softDeleteMode: db.softDeleteMode, updateOptions: db.updateOptions}
 	}
-	sqlTx, err := db.conn.Begin()
+	conn, err := db.pool.getWriteConn()
 	if err != nil {
+		use.release()
+		return &Tx{QuoteTag: db.QuoteTag, logSlow: conf.LogSlow.TimeDuration(), Error: err, logger: db.logger, settings: db.settings, softDeleteMode: db.softDeleteMode, updateOptions: db.updateOptions}
+	}
+	sqlTx, err := conn.Begin()
+	if err != nil {
+		use.release()
 		db.logger.LogError(err.Error())
-		return &Tx{QuoteTag: db.QuoteTag, logSlow: db.Config.LogSlow.TimeDuration(), Error: nil, logger: db.logger}
+		return &Tx{QuoteTag: db.QuoteTag, logSlow: conf.LogSlow.TimeDuration(), Error: err, logger: db.logger, settings: db.settings, softDeleteMode: db.softDeleteMode, updateOptions: db.updateOptions}
 	}
-	return &Tx{QuoteTag: db.QuoteTag, logSlow: db.Config.LogSlow.TimeDuration(), conn: sqlTx, logger: db.logger}
+	return &Tx{QuoteTag: db.QuoteTag, logSlow: conf.LogSlow.TimeDuration(), conn: sqlTx, logger: db.logger, settings: db.settings, softDeleteMode: db.softDeleteMode, updateOptions: db.updateOptions, use: use}
 }
 
 func (db *DB) Exec(requestSql string, args ...interface{}) *ExecResult {
-	r := baseExec(db.conn, nil, requestSql, args...)
+	conf := db.pool.getConfig()
+	r := baseExec(db.pool, nil, db.settings, requestSql, args...)
 	r.logger = db.logger
+	db.logger.countQuery()
 	if r.Error != nil {
 		db.logger.LogQueryError(r.Error.Error(), requestSql, args, r.usedTime)
 	} else {
-		if db.Config.LogSlow > 0 && r.usedTime >= float32(db.Config.LogSlow.TimeDuration()/time.Millisecond) {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
 			// 记录慢请求日志
 			db.logger.LogQuery(requestSql, args, r.usedTime)
 		}
@@ -537,23 +733,14 @@ func (db *DB) Exec(requestSql string, args ...interface{}) *ExecResult {
 }
 
 func (db *DB) Query(requestSql string, args ...interface{}) *QueryResult {
-	conn := db.conn
-	if db.readonlyConnections != nil {
-		connNum := len(db.readonlyConnections)
-		if connNum == 1 {
-			conn = db.readonlyConnections[0]
-		} else {
-			p := u.GlobalRand1.Intn(connNum)
-			conn = db.readonlyConnections[p]
-		}
-	}
-
-	r := baseQuery(conn, nil, requestSql, args...)
+	conf := db.pool.getConfig()
+	r := baseQuery(db.pool, nil, db.settings, requestSql, args...)
 	r.logger = db.logger
+	db.logger.countQuery()
 	if r.Error != nil {
 		db.logger.LogQueryError(r.Error.Error(), requestSql, args, r.usedTime)
 	} else {
-		if db.Config.LogSlow > 0 && r.usedTime >= float32(db.Config.LogSlow.TimeDuration()/time.Millisecond) {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
 			// 记录慢请求日志
 			db.logger.LogQuery(requestSql, args, r.usedTime)
 		}
@@ -563,12 +750,14 @@ func (db *DB) Query(requestSql string, args ...interface{}) *QueryResult {
 
 func (db *DB) Insert(table string, data interface{}) *ExecResult {
 	requestSql, values := db.MakeInsertSql(table, data, false)
-	r := baseExec(db.conn, nil, requestSql, values...)
+	conf := db.pool.getConfig()
+	r := baseExec(db.pool, nil, db.settings, requestSql, values...)
 	r.logger = db.logger
+	db.logger.countQuery()
 	if r.Error != nil {
 		db.logger.LogQueryError(r.Error.Error(), requestSql, values, r.usedTime)
 	} else {
-		if db.Config.LogSlow > 0 && r.usedTime >= float32(db.Config.LogSlow.TimeDuration()/time.Millisecond) {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
 			// 记录慢请求日志
 			db.logger.LogQuery(requestSql, values, r.usedTime)
 		}
@@ -578,12 +767,36 @@ func (db *DB) Insert(table string, data interface{}) *ExecResult {
 
 func (db *DB) Replace(table string, data interface{}) *ExecResult {
 	requestSql, values := db.MakeInsertSql(table, data, true)
-	r := baseExec(db.conn, nil, requestSql, values...)
+	conf := db.pool.getConfig()
+	r := baseExec(db.pool, nil, db.settings, requestSql, values...)
 	r.logger = db.logger
+	db.logger.countQuery()
 	if r.Error != nil {
 		db.logger.LogQueryError(r.Error.Error(), requestSql, values, r.usedTime)
 	} else {
-		if db.Config.LogSlow > 0 && r.usedTime >= float32(db.Config.LogSlow.TimeDuration()/time.Millisecond) {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
+			// 记录慢请求日志
+			db.logger.LogQuery(requestSql, values, r.usedTime)
+		}
+	}
+	return r
+}
+
+// 一次插入多行，list 为 map 或结构体的数组
+func (db *DB) InsertMany(table string, list interface{}) *ExecResult {
+	requestSql, values := makeInsertManySql(db.settings, db.QuoteTag, table, list, db.updateOptions, false)
+	if requestSql == "" {
+		// 没有数据时不执行
+		return &ExecResult{Sql: &requestSql, logger: db.logger}
+	}
+	conf := db.pool.getConfig()
+	r := baseExec(db.pool, nil, db.settings, requestSql, values...)
+	r.logger = db.logger
+	db.logger.countQuery()
+	if r.Error != nil {
+		db.logger.LogQueryError(r.Error.Error(), requestSql, values, r.usedTime)
+	} else {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
 			// 记录慢请求日志
 			db.logger.LogQuery(requestSql, values, r.usedTime)
 		}
@@ -592,13 +805,20 @@ func (db *DB) Replace(table string, data interface{}) *ExecResult {
 }
 
 func (db *DB) Update(table string, data interface{}, wheres string, args ...interface{}) *ExecResult {
+	wheres = db.settings.makeSoftDeleteWheres(db.QuoteTag, table, wheres, db.softDeleteMode)
 	requestSql, values := db.MakeUpdateSql(table, data, wheres, args...)
-	r := baseExec(db.conn, nil, requestSql, values...)
+	if requestSql == "" {
+		db.logger.LogError(ErrNoFieldsToUpdate.Error())
+		return &ExecResult{Sql: &requestSql, Args: args, logger: db.logger, Error: ErrNoFieldsToUpdate}
+	}
+	conf := db.pool.getConfig()
+	r := baseExec(db.pool, nil, db.settings, requestSql, values...)
 	r.logger = db.logger
+	db.logger.countQuery()
 	if r.Error != nil {
 		db.logger.LogQueryError(r.Error.Error(), requestSql, values, r.usedTime)
 	} else {
-		if db.Config.LogSlow > 0 && r.usedTime >= float32(db.Config.LogSlow.TimeDuration()/time.Millisecond) {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
 			// 记录慢请求日志
 			db.logger.LogQuery(requestSql, values, r.usedTime)
 		}
@@ -607,16 +827,15 @@ func (db *DB) Update(table string, data interface{}, wheres string, args ...inte
 }
 
 func (db *DB) Delete(table string, wheres string, args ...interface{}) *ExecResult {
-	if wheres != "" {
-		wheres = " where " + wheres
-	}
-	requestSql := fmt.Sprintf("delete from %s%s", db.Quote(table), wheres)
-	r := baseExec(db.conn, nil, requestSql, args...)
+	requestSql, args := db.settings.makeDeleteSql(db.QuoteTag, table, wheres, db.softDeleteMode, args)
+	conf := db.pool.getConfig()
+	r := baseExec(db.pool, nil, db.settings, requestSql, args...)
 	r.logger = db.logger
+	db.logger.countQuery()
 	if r.Error != nil {
 		db.logger.LogQueryError(r.Error.Error(), requestSql, args, r.usedTime)
 	} else {
-		if db.Config.LogSlow > 0 && r.usedTime >= float32(db.Config.LogSlow.TimeDuration()/time.Millisecond) {
+		if conf.LogSlow > 0 && r.usedTime >= float32(conf.LogSlow.TimeDuration()/time.Millisecond) {
 			// 记录慢请求日志
 			db.logger.LogQuery(requestSql, args, r.usedTime)
 		}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ssgo/u"
+)
+
+// Decimal 精确的十进制数，用于 DECIMAL、NUMERIC 类型的字段（例如金额），保留数据库返回的小数位数
+// 实现了 sql.Scanner 和 driver.Valuer，可以为 NULL 的字段使用 *Decimal
+type Decimal struct {
+	value string
+}
+
+// ParseDecimal 解析十进制数，例如 12.50、-0.1、+3，不支持科学计数法
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	if !decimalMatcher.MatchString(str) {
+		return Decimal{}, fmt.Errorf("bad decimal %q", s)
+	}
+	str = strings.TrimPrefix(str, "+")
+	negative := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(str, "-")
+
+	intPart, fracPart, hasFrac := strings.Cut(str, ".")
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	str = intPart
+	if hasFrac && fracPart != "" {
+		str += "." + fracPart
+	}
+	if negative && strings.Trim(str, "0.") != "" {
+		str = "-" + str
+	}
+	return Decimal{value: str}, nil
+}
+
+func (d Decimal) String() string {
+	if d.value == "" {
+		return "0"
+	}
+	return d.value
+}
+
+// Scale 小数位数
+func (d Decimal) Scale() int {
+	if _, frac, ok := strings.Cut(d.value, "."); ok {
+		return len(frac)
+	}
+	return 0
+}
+
+func (d Decimal) IsZero() bool {
+	return strings.Trim(d.String(), "-0.") == ""
+}
+
+// Rat 转换为 big.Rat 用于精确计算
+func (d Decimal) Rat() *big.Rat {
+	r, _ := new(big.Rat).SetString(d.String())
+	return r
+}
+
+// Float64 会损失精度，只在需要时显式调用
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Scan NULL 时为 0，需要区分 NULL 时使用 *Decimal
+func (d *Decimal) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	case float64:
+		str = strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		str = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		str = u.String(v)
+	}
+	parsed, err := ParseDecimal(str)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value 以字符串传给驱动，避免转换为 float64
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON 输出为 JSON 数字，保留小数位数
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON 支持数字和字符串
+func (d *Decimal) UnmarshalJSON(buf []byte) error {
+	str := string(buf)
+	if str == "null" {
+		return nil
+	}
+	if strings.HasPrefix(str, "\"") {
+		if err := json.Unmarshal(buf, &str); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseDecimal(str)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// 将 DECIMAL 字段扫描到的值转换为 Decimal，无法解析时保留原值
+func makeDecimalValue(v reflect.Value) reflect.Value {
+	d := Decimal{}
+	if err := d.Scan(v.Interface()); err == nil {
+		return reflect.ValueOf(d)
+	}
+	return v
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type DumpOptions struct {
+	Tables    []string          // 导出的表，默认为所有表
+	Wheres    map[string]string // 每个表的过滤条件
+	Limit     int               // 每个表最多导出的行数，0 表示不限制
+	BatchSize int               // 每个 INSERT 语句包含的行数，默认 100
+	DropTable bool              // 在 CREATE TABLE 前输出 DROP TABLE IF EXISTS
+	NoSchema  bool              // 不输出 CREATE TABLE
+	NoData    bool              // 不输出数据
+}
+
+// 获得所有表名，支持 sqlite 和 mysql
+func (db *DB) Tables() ([]string, error) {
+	var r *QueryResult
+	switch db.pool.getConfig().Type {
+	case "sqlite", "sqlite3":
+		r = db.Query("select name from sqlite_master where type='table' and name not like 'sqlite_%' order by name")
+	case "mysql":
+		r = db.Query("show tables")
+	default:
+		return nil, errors.New("list tables is not supported for " + db.pool.getConfig().Type)
+	}
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return r.StringsOnC1(), nil
+}
+
+// 获得建表语句，不支持的数据库按字段信息生成
+func (db *DB) CreateTableSql(table string) (string, error) {
+	switch db.pool.getConfig().Type {
+	case "sqlite", "sqlite3":
+		r := db.Query("select sql from sqlite_master where type='table' and name=?", table)
+		if r.Error != nil {
+			return "", r.Error
+		}
+		if createSql := r.StringOnR1C1(); createSql != "" {
+			return createSql, nil
+		}
+	case "mysql":
+		r := db.Query("show create table " + db.Quote(table))
+		if r.Error != nil {
+			return "", r.Error
+		}
+		if row := r.StringSliceResults(); len(row) > 0 && len(row[0]) > 1 {
+			return row[0][1], nil
+		}
+	}
+
+	columns, err := db.TableColumns(table)
+	if err != nil {
+		return "", err
+	}
+	fields := make([]string, len(columns))
+	for i, col := range columns {
+		fields[i] = db.Quote(col.Name) + " " + col.Type
+		if !col.Nullable {
+			fields[i] += " NOT NULL"
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", db.Quote(table), strings.Join(fields, ", ")), nil
+}
+
+// 导出数据时的排序字段，使用主键，没有主键时使用所有字段，保证每次导出的顺序相同
+func (db *DB) dumpOrderColumns(table string) ([]string, error) {
+	var r *QueryResult
+	switch db.pool.getConfig().Type {
+	case "sqlite", "sqlite3":
+		r = db.Query("select name from pragma_table_info(?) where pk>0 order by pk", table)
+	case "mysql":
+		r = db.Query("select column_name from information_schema.key_column_usage where table_schema=database() and table_name=? and constraint_name='PRIMARY' order by ordinal_position", table)
+	}
+	if r != nil {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		if keys := r.StringsOnC1(); len(keys) > 0 {
+			return keys, nil
+		}
+	}
+
+	columns, err := db.TableColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return names, nil
+}
+
+// 将表结构和数据导出为 SQL 脚本，使用当前数据库的引号和语法
+func (db *DB) Dump(w io.Writer, opts *DumpOptions) error {
+	opt := &DumpOptions{}
+	if opts != nil {
+		*opt = *opts
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 100
+	}
+	tables := opt.Tables
+	if len(tables) == 0 {
+		var err error
+		if tables, err = db.Tables(); err != nil {
+			return err
+		}
+	}
+
+	writer := bufio.NewWriter(w)
+	isMysql := db.pool.getConfig().Type == "mysql"
+	if isMysql {
+		_, _ = writer.WriteString("SET FOREIGN_KEY_CHECKS=0;\n\n")
+	}
+	for _, table := range tables {
+		if err := db.dumpTable(writer, table, opt); err != nil {
+			return err
+		}
+	}
+	if isMysql {
+		_, _ = writer.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+	return writer.Flush()
+}
+
+func (db *DB) dumpTable(writer *bufio.Writer, table string, opt *DumpOptions) error {
+	_, _ = writer.WriteString("-- " + table + "\n")
+	if !opt.NoSchema {
+		if opt.DropTable {
+			_, _ = writer.WriteString("DROP TABLE IF EXISTS " + db.Quote(table) + ";\n")
+		}
+		createSql, err := db.CreateTableSql(table)
+		if err != nil {
+			return err
+		}
+		_, _ = writer.WriteString(createSql + ";\n")
+	}
+	if opt.NoData {
+		_, _ = writer.WriteString("\n")
+		return nil
+	}
+
+	requestSql := "select * from " + db.Quote(table)
+	if wheres := opt.Wheres[table]; wheres != "" {
+		requestSql += " where " + wheres
+	}
+	orderColumns, err := db.dumpOrderColumns(table)
+	if err != nil {
+		return err
+	}
+	requestSql += " order by " + quotes(db.QuoteTag, orderColumns)
+	if opt.Limit > 0 {
+		requestSql += " limit " + strconv.Itoa(opt.Limit)
+	}
+	r := db.Query(requestSql)
+	if r.Error != nil {
+		return r.Error
+	}
+
+	isMysql := db.pool.getConfig().Type == "mysql"
+	insertSql := ""
+	rowsNum := 0
+	_, err = r.exportRows(&ExportOptions{NoHeader: true, TimeFormat: "2006-01-02 15:04:05.999999"}, nil, func(columns []string, values []interface{}) error {
+		if insertSql == "" {
+			insertSql = "INSERT INTO " + db.Quote(table) + " (" + quotes(db.QuoteTag, append([]string{}, columns...)) + ") VALUES\n"
+		}
+		if rowsNum == 0 {
+			_, _ = writer.WriteString(insertSql)
+		} else {
+			_, _ = writer.WriteString(",\n")
+		}
+		literals := make([]string, len(values))
+		for i, v := range values {
+			literals[i] = makeSqlLiteral(v, isMysql)
+		}
+		_, err := writer.WriteString("(" + strings.Join(literals, ",") + ")")
+		rowsNum++
+		if rowsNum >= opt.BatchSize {
+			_, err = writer.WriteString(";\n")
+			rowsNum = 0
+		}
+		return err
+	})
+	if rowsNum > 0 {
+		_, _ = writer.WriteString(";\n")
+	}
+	_, _ = writer.WriteString("\n")
+	return err
+}
+
+// 将 exportRows 转换后的值生成为 SQL 字面量
+func makeSqlLiteral(v interface{}, isMysql bool) string {
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	case exportBytes:
+		return "X'" + hex.EncodeToString(value) + "'"
+	case exportTime:
+		return "'" + value.t.Format(value.layout) + "'"
+	case string:
+		if !utf8.ValidString(value) {
+			return "X'" + hex.EncodeToString([]byte(value)) + "'"
+		}
+		value = strings.ReplaceAll(value, "'", "''")
+		if isMysql {
+			value = strings.ReplaceAll(value, "\\", "\\\\")
+		}
+		return "'" + value + "'"
+	}
+	return "NULL"
+}
+
+// 执行 Dump 生成的脚本（或其他以分号分隔的 SQL 脚本），所有语句在一个事务中执行（Restore 用于恢复软删除的数据）
+// mysql 中 CREATE、DROP 等 DDL 会隐式提交事务，出错时已经执行的 DDL 和之前的数据不会回滚
+func (db *DB) RestoreDump(reader io.Reader) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	bufReader := bufio.NewReader(reader)
+	for n := 1; ; n++ {
+		requestSql, err := readSqlStatement(bufReader, db.pool.getConfig().Type == "mysql")
+		if requestSql != "" {
+			if r := tx.Exec(requestSql); r.Error != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("restore statement %d failed: %w", n, r.Error)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 读取一条以分号结束的语句，忽略引号中的分号和注释，mysql 的字符串中可以使用反斜杠转义，并且支持 # 注释
+func readSqlStatement(reader *bufio.Reader, isMysql bool) (string, error) {
+	buf := strings.Builder{}
+	var quoteChar rune
+	for {
+		c, _, err := reader.ReadRune()
+		if err != nil {
+			return strings.TrimSpace(buf.String()), err
+		}
+		if quoteChar != 0 {
+			buf.WriteRune(c)
+			if c == '\\' && isMysql && quoteChar != '`' {
+				// 保留转义的字符
+				if next, _, err := reader.ReadRune(); err == nil {
+					buf.WriteRune(next)
+				}
+			} else if c == quoteChar {
+				quoteChar = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quoteChar = c
+			buf.WriteRune(c)
+		case '-':
+			if next, _ := reader.Peek(1); len(next) == 1 && next[0] == '-' {
+				_, _ = reader.ReadString('\n')
+				buf.WriteRune('\n')
+			} else {
+				buf.WriteRune(c)
+			}
+		case '#':
+			if isMysql {
+				_, _ = reader.ReadString('\n')
+				buf.WriteRune('\n')
+			} else {
+				buf.WriteRune(c)
+			}
+		case '/':
+			if next, _ := reader.Peek(1); len(next) == 1 && next[0] == '*' {
+				_, _, _ = reader.ReadRune()
+				for {
+					if _, err := reader.ReadString('*'); err != nil {
+						return strings.TrimSpace(buf.String()), err
+					}
+					if next, _ := reader.Peek(1); len(next) == 1 && next[0] == '/' {
+						_, _, _ = reader.ReadRune()
+						break
+					}
+				}
+				buf.WriteRune(' ')
+			} else {
+				buf.WriteRune(c)
+			}
+		case ';':
+			if statement := strings.TrimSpace(buf.String()); statement != "" {
+				return statement, nil
+			}
+		default:
+			buf.WriteRune(c)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ssgo/u"
+)
+
+type ExportOptions struct {
+	NoHeader    bool   // 不输出表头
+	Null        string // NULL 输出的内容，默认为空（JSONL 中为 null）
+	TimeFormat  string // 默认为 2006-01-02 15:04:05，DATE 类型只输出日期
+	BytesFormat string // 二进制数据的格式：hex、base64，默认 CSV/TSV 为 hex、JSONL 为 base64
+	Comma       rune   // CSV 的分隔符，默认为逗号
+	BOM         bool   // 输出 UTF-8 BOM，便于 Excel 识别编码
+}
+
+var exportTimeLayouts = map[string]string{
+	"DATE": "2006-01-02",
+	"TIME": "15:04:05",
+}
+
+// 逐行写入 CSV，不会将所有数据加载到内存中，返回写入的行数，不传 opts 时使用默认设置
+func (r *QueryResult) WriteCSV(w io.Writer, opts ...*ExportOptions) (int64, error) {
+	opt := makeExportOptions(opts, "hex")
+	if opt.BOM {
+		if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return 0, err
+		}
+	}
+	writer := csv.NewWriter(w)
+	if opt.Comma != 0 {
+		writer.Comma = opt.Comma
+	}
+	n, err := r.exportRows(opt, func(columns []string) error {
+		return writer.Write(columns)
+	}, func(columns []string, values []interface{}) error {
+		record := make([]string, len(values))
+		for i, v := range values {
+			record[i] = exportString(v, opt)
+		}
+		return writer.Write(record)
+	})
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	return n, err
+}
+
+// 制表符分隔，值中的制表符、换行和反斜杠会被转义
+func (r *QueryResult) WriteTSV(w io.Writer, opts ...*ExportOptions) (int64, error) {
+	opt := makeExportOptions(opts, "hex")
+	writer := bufio.NewWriter(w)
+	if opt.BOM {
+		_, _ = writer.WriteString("\xEF\xBB\xBF")
+	}
+	writeLine := func(record []string) error {
+		for i, v := range record {
+			record[i] = tsvEscaper.Replace(v)
+		}
+		_, err := writer.WriteString(strings.Join(record, "\t") + "\n")
+		return err
+	}
+	n, err := r.exportRows(opt, writeLine, func(columns []string, values []interface{}) error {
+		record := make([]string, len(values))
+		for i, v := range values {
+			record[i] = exportString(v, opt)
+		}
+		return writeLine(record)
+	})
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	return n, err
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// 每行输出一个 JSON 对象，字段按查询结果的顺序
+func (r *QueryResult) WriteJSONL(w io.Writer, opts ...*ExportOptions) (int64, error) {
+	opt := makeExportOptions(opts, "base64")
+	opt.NoHeader = true
+	writer := bufio.NewWriter(w)
+	var keys [][]byte
+	n, err := r.exportRows(opt, nil, func(columns []string, values []interface{}) error {
+		if keys == nil {
+			keys = make([][]byte, len(columns))
+			for i, column := range columns {
+				keys[i], _ = json.Marshal(column)
+			}
+		}
+		_ = writer.WriteByte('{')
+		for i, v := range values {
+			if i > 0 {
+				_ = writer.WriteByte(',')
+			}
+			_, _ = writer.Write(keys[i])
+			_ = writer.WriteByte(':')
+			var buf []byte
+			var err error
+			switch value := v.(type) {
+			case nil:
+				buf = []byte("null")
+			case int64, float64, bool:
+				buf, err = json.Marshal(value)
+			default:
+				buf, err = json.Marshal(exportString(v, opt))
+			}
+			if err != nil {
+				return err
+			}
+			_, _ = writer.Write(buf)
+		}
+		_, err := writer.WriteString("}\n")
+		return err
+	})
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	return n, err
+}
+
+func makeExportOptions(opts []*ExportOptions, bytesFormat string) *ExportOptions {
+	opt := &ExportOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if opt.TimeFormat == "" {
+		opt.TimeFormat = "2006-01-02 15:04:05"
+	}
+	if opt.BytesFormat == "" {
+		opt.BytesFormat = bytesFormat
+	}
+	return opt
+}
+
+type exportBytes []byte
+
+type exportTime struct {
+	t      time.Time
+	layout string
+}
+
+// 逐行读取，值转换为 nil、int64、float64、bool、string、exportBytes、exportTime
+func (r *QueryResult) exportRows(opt *ExportOptions, writeHeader func([]string) error, writeRow func([]string, []interface{}) error) (int64, error) {
+	if r.rows == nil {
+		return 0, errors.New("not a valid query result")
+	}
+	defer r.Complete()
+
+	colTypes, err := r.rows.ColumnTypes()
+	if err != nil {
+		r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
+		return 0, err
+	}
+	columns := make([]string, len(colTypes))
+	typeNames := make([]string, len(colTypes))
+	for i, col := range colTypes {
+		columns[i] = col.Name()
+		typeNames[i] = strings.ToUpper(col.DatabaseTypeName())
+	}
+	if !opt.NoHeader && writeHeader != nil {
+		if err := writeHeader(columns); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int64
+	row := make([]interface{}, len(colTypes))
+	scanValues := make([]interface{}, len(colTypes))
+	for i := range row {
+		scanValues[i] = &row[i]
+	}
+	values := make([]interface{}, len(colTypes))
+	for r.rows.Next() {
+		for i := range row {
+			row[i] = nil
+		}
+		if err := r.rows.Scan(scanValues...); err != nil {
+			r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
+			return n, err
+		}
+		r.logger.countBytesScanned(scannedBytes(scanValues))
+		for i, v := range row {
+			values[i] = exportValue(typeNames[i], v, opt)
+		}
+		if err := writeRow(columns, values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := r.rows.Err(); err != nil {
+		r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
+		return n, err
+	}
+	return n, nil
+}
+
+func isBinaryType(typeName string) bool {
+	return strings.Contains(typeName, "BLOB") || strings.Contains(typeName, "BINARY") || typeName == "BYTEA"
+}
+
+func exportValue(typeName string, v interface{}, opt *ExportOptions) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if isBinaryType(typeName) || !utf8.Valid(value) {
+			return exportBytes(value)
+		}
+		return fixValue(typeName, reflect.ValueOf(string(value))).String()
+	case string:
+		return fixValue(typeName, reflect.ValueOf(value)).String()
+	case time.Time:
+		layout := exportTimeLayouts[typeName]
+		if layout == "" {
+			layout = opt.TimeFormat
+		}
+		return exportTime{t: value, layout: layout}
+	case int64, float64, bool:
+		return value
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return fixValue(typeName, reflect.ValueOf(u.String(v))).String()
+}
+
+func exportString(v interface{}, opt *ExportOptions) string {
+	switch value := v.(type) {
+	case nil:
+		return opt.Null
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case exportBytes:
+		if opt.BytesFormat == "base64" {
+			return base64.StdEncoding.EncodeToString(value)
+		}
+		return hex.EncodeToString(value)
+	case exportTime:
+		return value.t.Format(value.layout)
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ssgo/u"
+)
+
+// ToGroups 按字段分组，target 为 *map[K][]T，T 的转换与 To 相同，keyColumn 默认为第一列
+// T 为单个值时使用第一个不是 keyColumn 的列
+func (r *QueryResult) ToGroups(target interface{}, keyColumn ...string) error {
+	if len(keyColumn) == 0 {
+		colTypes, err := r.getColumnTypes()
+		if err != nil {
+			r.Complete()
+			return err
+		}
+		keyColumn = []string{colTypes[0].Name()}
+	}
+	t := reflect.TypeOf(target)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Map || t.Elem().Elem().Kind() != reflect.Slice {
+		err := errors.New("target not a pointer of map of slice")
+		r.Complete()
+		r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
+		return err
+	}
+	return r.ToTree(target, keyColumn[0])
+}
+
+// ToTree 按多个字段生成多层 Map，target 为 *map[K1]map[K2]T，最后一层为 Slice 时按分组处理，否则相同的 key 后面的数据覆盖前面的
+func (r *QueryResult) ToTree(target interface{}, keyColumns ...string) error {
+	if r.rows == nil {
+		return errors.New("operate on a bad query")
+	}
+	err := r.makeTree(target, keyColumns, false)
+	if err != nil {
+		r.Complete()
+		r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
+	}
+	return err
+}
+
+// merge 为 true 时 Map 或结构体的值合并到已有的值中
+func (r *QueryResult) makeTree(target interface{}, keyColumns []string, merge bool) error {
+	if len(keyColumns) == 0 {
+		return errors.New("no key columns")
+	}
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() == reflect.Map && !targetValue.IsNil() {
+		// 不为 nil 的 Map 可以直接传入
+		ptr := reflect.New(targetValue.Type())
+		ptr.Elem().Set(targetValue)
+		targetValue = ptr
+	}
+	if targetValue.Kind() != reflect.Ptr || targetValue.Elem().Kind() != reflect.Map {
+		return errors.New("target not a pointer of map")
+	}
+	leafType := targetValue.Elem().Type()
+	for range keyColumns {
+		if leafType.Kind() != reflect.Map {
+			return fmt.Errorf("target need %d levels of map", len(keyColumns))
+		}
+		leafType = leafType.Elem()
+	}
+	isGroup := leafType.Kind() == reflect.Slice && leafType.Elem().Kind() != reflect.Uint8
+	elemType := leafType
+	if isGroup {
+		elemType = leafType.Elem()
+	}
+
+	colTypes, err := r.getColumnTypes()
+	if err != nil {
+		return err
+	}
+	keyIndexes := make([]int, len(keyColumns))
+	for i, keyColumn := range keyColumns {
+		keyIndexes[i] = -1
+		for colIndex, col := range colTypes {
+			if strings.EqualFold(col.Name(), keyColumn) {
+				keyIndexes[i] = colIndex
+				break
+			}
+		}
+		if keyIndexes[i] == -1 {
+			return fmt.Errorf("key column %s not found", keyColumn)
+		}
+	}
+	isKey := make(map[int]bool)
+	for _, colIndex := range keyIndexes {
+		isKey[colIndex] = true
+	}
+	for colIndex := range colTypes {
+		if !isKey[colIndex] {
+			r.valueIndex = colIndex
+			break
+		}
+	}
+
+	// 与 To 使用相同的方式转换数据，同时记录每行的 key
+	keys := make([][]interface{}, 0)
+	r.onRow = func(scanValues []interface{}) {
+		rowKeys := make([]interface{}, len(keyIndexes))
+		for i, colIndex := range keyIndexes {
+			rowKeys[i] = scannedValue(scanValues[colIndex])
+		}
+		keys = append(keys, rowKeys)
+	}
+	list := reflect.New(reflect.SliceOf(elemType))
+	if err := r.makeResults(list.Interface(), r.rows); err != nil {
+		return err
+	}
+
+	root := targetValue.Elem()
+	if root.IsNil() {
+		root.Set(reflect.MakeMap(root.Type()))
+	}
+	listValue := list.Elem()
+	for i := 0; i < listValue.Len(); i++ {
+		m := root
+		for level, keyValue := range keys[i] {
+			key := reflect.New(m.Type().Key())
+			u.Convert(keyValue, key.Interface())
+			if level < len(keys[i])-1 {
+				child := m.MapIndex(key.Elem())
+				if !child.IsValid() || child.IsNil() {
+					child = reflect.MakeMap(m.Type().Elem())
+					m.SetMapIndex(key.Elem(), child)
+				}
+				m = child
+			} else if isGroup {
+				group := m.MapIndex(key.Elem())
+				if !group.IsValid() {
+					group = reflect.MakeSlice(leafType, 0, 1)
+				}
+				m.SetMapIndex(key.Elem(), reflect.Append(group, listValue.Index(i)))
+			} else if oldValue := m.MapIndex(key.Elem()); merge && oldValue.IsValid() {
+				m.SetMapIndex(key.Elem(), r.mergeValue(oldValue, listValue.Index(i), colTypes))
+			} else {
+				m.SetMapIndex(key.Elem(), listValue.Index(i))
+			}
+		}
+	}
+	return nil
+}
+
+// 获得扫描到的值，NULL 返回 nil
+func scannedValue(ptr interface{}) interface{} {
+	v := reflect.ValueOf(ptr)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if buf, ok := v.Interface().([]byte); ok {
+		return string(buf)
+	}
+	return v.Interface()
+}
+
+// 将新的值合并到已有的值中，结构体只修改查询结果中有的字段，指针指向的值直接修改
+func (r *QueryResult) mergeValue(oldValue, newValue reflect.Value, colTypes []*sql.ColumnType) reflect.Value {
+	if oldValue.Kind() == reflect.Ptr {
+		if oldValue.IsNil() || newValue.IsNil() {
+			return newValue
+		}
+		merged := r.mergeValue(oldValue.Elem(), newValue.Elem(), colTypes)
+		oldValue.Elem().Set(merged)
+		return oldValue
+	}
+	switch oldValue.Kind() {
+	case reflect.Map:
+		if oldValue.IsNil() {
+			return newValue
+		}
+		iter := newValue.MapRange()
+		for iter.Next() {
+			oldValue.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return oldValue
+	case reflect.Struct:
+		if isTimeType(oldValue.Type()) || isScannerType(oldValue.Type()) {
+			return newValue
+		}
+		merged := reflect.New(oldValue.Type()).Elem()
+		merged.Set(oldValue)
+		mapper := r.settings.getNameMapper()
+		for _, col := range colTypes {
+			if fieldName, _, found := mapper.findField(oldValue.Type(), col.Name()); found {
+				merged.FieldByName(fieldName).Set(newValue.FieldByName(fieldName))
+			}
+		}
+		return merged
+	}
+	return newValue
+}
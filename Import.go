@@ -0,0 +1,406 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ssgo/u"
+)
+
+type ImportMode int
+
+const (
+	ImportInsert  ImportMode = iota
+	ImportReplace            // replace into
+	ImportUpsert             // mysql 使用 on duplicate key update，其他数据库使用 on conflict (Keys) do update
+)
+
+type ImportOptions struct {
+	Mode      ImportMode
+	Keys      []string          // ImportUpsert 时冲突判断的字段（mysql 不需要）
+	BatchSize int               // 每批插入的行数，默认 500，行数乘以字段数超过数据库参数数量的限制时自动减少
+	Columns   map[string]string // 表头到字段名的映射，未设置的按名称匹配（不区分大小写）
+	Comma     rune              // CSV 的分隔符，默认为逗号
+	Null      string            // CSV 中表示 NULL 的内容，非字符串类型的空值总是作为 NULL
+}
+
+type ImportError struct {
+	Line  int
+	Error string
+}
+
+type ImportReport struct {
+	Total    int64
+	Imported int64
+	Errors   []ImportError
+}
+
+var decimalMatcher = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)$`)
+
+type importRow struct {
+	line   int
+	values []interface{}
+}
+
+type importer struct {
+	db      *DB
+	table   string
+	opt     *ImportOptions
+	columns []*TableColumn
+	indexes []int // 每个输入字段对应的表字段，-1 表示没有对应
+	report  *ImportReport
+	batch   []importRow
+	keys    []string
+	// 按字段数限制后的每批行数
+	batchSize int
+}
+
+// 单条语句参数数量的限制
+func maxPlaceholders(dbType string) int {
+	if isFileDB(dbType) {
+		return 32766
+	}
+	return 65535
+}
+
+func (db *DB) newImporter(table string, opts *ImportOptions) (*importer, error) {
+	opt := &ImportOptions{}
+	if opts != nil {
+		*opt = *opts
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 500
+	}
+	if opt.Mode == ImportUpsert && len(opt.Keys) == 0 && db.pool.getConfig().Type != "mysql" {
+		return nil, errors.New("import upsert need keys")
+	}
+	columns, err := db.TableColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	return &importer{db: db, table: table, opt: opt, columns: columns, report: &ImportReport{Errors: make([]ImportError, 0)}}, nil
+}
+
+// 将表头对应到表字段，不存在的字段返回错误
+func (im *importer) setHeader(header []string) error {
+	im.indexes = make([]int, len(header))
+	im.keys = make([]string, 0, len(header))
+	for i, name := range header {
+		if mapped := im.opt.Columns[name]; mapped != "" {
+			name = mapped
+		}
+		im.indexes[i] = -1
+		for j, col := range im.columns {
+			if strings.EqualFold(col.Name, strings.TrimSpace(name)) {
+				im.indexes[i] = j
+				im.keys = append(im.keys, col.Name)
+				break
+			}
+		}
+		if im.indexes[i] == -1 {
+			return fmt.Errorf("column %s not exists in %s", name, im.table)
+		}
+	}
+	im.batchSize = im.opt.BatchSize
+	if len(im.keys) > 0 {
+		if maxRows := maxPlaceholders(im.db.pool.getConfig().Type) / len(im.keys); im.batchSize > maxRows {
+			im.batchSize = maxRows
+		}
+	}
+	return nil
+}
+
+func (im *importer) addError(line int, err error) {
+	im.report.Errors = append(im.report.Errors, ImportError{Line: line, Error: err.Error()})
+}
+
+func (im *importer) add(line int, values []interface{}) {
+	im.report.Total++
+	if len(values) != len(im.indexes) {
+		im.addError(line, fmt.Errorf("expect %d fields but got %d", len(im.indexes), len(values)))
+		return
+	}
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		col := im.columns[im.indexes[i]]
+		value, err := coerceImportValue(col, v, im.opt.Null)
+		if err != nil {
+			im.addError(line, fmt.Errorf("%s: %w", col.Name, err))
+			return
+		}
+		row[i] = value
+	}
+	im.batch = append(im.batch, importRow{line: line, values: row})
+	if len(im.batch) >= im.batchSize {
+		im.flush()
+	}
+}
+
+// 在事务中插入一批数据，失败时在事务中逐行重试以找出出错的行，出错的行回滚到 savepoint
+func (im *importer) flush() {
+	if len(im.batch) == 0 {
+		return
+	}
+	batch := im.batch
+	im.batch = nil
+
+	values := make([]interface{}, 0, len(batch)*len(im.keys))
+	for _, row := range batch {
+		values = append(values, row.values...)
+	}
+	tx := im.db.Begin()
+	if tx.Error == nil {
+		r := tx.Exec(im.makeSql(len(batch)), values...)
+		if r.Error == nil && tx.Commit() == nil {
+			im.report.Imported += int64(len(batch))
+			return
+		}
+		_ = tx.Rollback()
+	}
+
+	tx = im.db.Begin()
+	if tx.Error != nil {
+		for _, row := range batch {
+			im.addError(row.line, tx.Error)
+		}
+		return
+	}
+	requestSql := im.makeSql(1)
+	importedLines := make([]int, 0, len(batch))
+	for _, row := range batch {
+		if r := tx.Exec("savepoint import_row"); r.Error != nil {
+			im.addError(row.line, r.Error)
+			continue
+		}
+		if r := tx.Exec(requestSql, row.values...); r.Error != nil {
+			tx.Exec("rollback to savepoint import_row")
+			im.addError(row.line, r.Error)
+		} else {
+			tx.Exec("release savepoint import_row")
+			importedLines = append(importedLines, row.line)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		for _, line := range importedLines {
+			im.addError(line, err)
+		}
+		return
+	}
+	im.report.Imported += int64(len(importedLines))
+}
+
+func (im *importer) makeSql(rowsNum int) string {
+	quoteTag := im.db.QuoteTag
+	vars := "(" + strings.TrimSuffix(strings.Repeat("?,", len(im.keys)), ",") + ")"
+	varsList := make([]string, rowsNum)
+	for i := range varsList {
+		varsList[i] = vars
+	}
+	operation := "insert"
+	if im.opt.Mode == ImportReplace {
+		operation = "replace"
+	}
+	requestSql := fmt.Sprintf("%s into %s (%s) values %s", operation, quote(quoteTag, im.table), quotes(quoteTag, append([]string{}, im.keys...)), strings.Join(varsList, ","))
+
+	if im.opt.Mode == ImportUpsert {
+		sets := make([]string, 0, len(im.keys))
+		if im.db.pool.getConfig().Type == "mysql" {
+			for _, k := range im.keys {
+				sets = append(sets, fmt.Sprintf("%s=values(%s)", quote(quoteTag, k), quote(quoteTag, k)))
+			}
+			requestSql += " on duplicate key update " + strings.Join(sets, ",")
+		} else {
+			for _, k := range im.keys {
+				if !u.StringIn(im.opt.Keys, k) {
+					sets = append(sets, fmt.Sprintf("%s=excluded.%s", quote(quoteTag, k), quote(quoteTag, k)))
+				}
+			}
+			requestSql += " on conflict (" + quotes(quoteTag, append([]string{}, im.opt.Keys...)) + ")"
+			if len(sets) > 0 {
+				requestSql += " do update set " + strings.Join(sets, ",")
+			} else {
+				requestSql += " do nothing"
+			}
+		}
+	}
+	return requestSql
+}
+
+// 按字段类型转换，数字和布尔类型的空值作为 NULL，DECIMAL 保持字符串以免丢失精度
+func coerceImportValue(col *TableColumn, v interface{}, null string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var str string
+	switch value := v.(type) {
+	case string:
+		if null != "" && value == null {
+			return nil, nil
+		}
+		str = value
+	case json.Number:
+		str = value.String()
+	case bool:
+		str = strconv.FormatBool(value)
+	case map[string]interface{}, []interface{}:
+		return u.Json(value), nil
+	default:
+		str = u.String(value)
+	}
+
+	kind := getColumnKind(col.Type)
+	if kind != columnKindString && strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+	str2 := strings.TrimSpace(str)
+	switch kind {
+	case columnKindInt:
+		if i, err := strconv.ParseInt(str2, 10, 64); err == nil {
+			return i, nil
+		}
+		if b, err := strconv.ParseBool(str2); err == nil {
+			return u.Int64(b), nil
+		}
+		return nil, fmt.Errorf("bad integer %q", str)
+	case columnKindFloat:
+		f, err := strconv.ParseFloat(str2, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", str)
+		}
+		return f, nil
+	case columnKindDecimal:
+		if !decimalMatcher.MatchString(str2) {
+			return nil, fmt.Errorf("bad decimal %q", str)
+		}
+		return str2, nil
+	case columnKindBool:
+		b, err := strconv.ParseBool(str2)
+		if err != nil {
+			return nil, fmt.Errorf("bad bool %q", str)
+		}
+		return b, nil
+	}
+	return str, nil
+}
+
+// 从 CSV 导入数据，第一行为表头，返回的报告中包含出错的行号
+func (db *DB) ImportCSV(table string, reader io.Reader, opts *ImportOptions) (*ImportReport, error) {
+	im, err := db.newImporter(table, opts)
+	if err != nil {
+		return nil, err
+	}
+	csvReader := csv.NewReader(bufio.NewReader(reader))
+	if im.opt.Comma != 0 {
+		csvReader.Comma = im.opt.Comma
+	}
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\xEF\xBB\xBF")
+	}
+	if err := im.setHeader(append([]string{}, header...)); err != nil {
+		return nil, err
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				im.report.Total++
+				im.addError(parseErr.StartLine, err)
+				continue
+			}
+			return im.report, err
+		}
+		line, _ := csvReader.FieldPos(0)
+		values := make([]interface{}, len(record))
+		for i, v := range record {
+			values[i] = v
+		}
+		im.add(line, values)
+	}
+	im.flush()
+	return im.report, nil
+}
+
+// 从 JSON Lines 导入数据，字段由第一行确定，之后每行的字段需要一致
+func (db *DB) ImportJSONL(table string, reader io.Reader, opts *ImportOptions) (*ImportReport, error) {
+	im, err := db.newImporter(table, opts)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var header []string
+	line := 0
+	for scanner.Scan() {
+		line++
+		buf := bytes.TrimSpace(scanner.Bytes())
+		if len(buf) == 0 {
+			continue
+		}
+		item := make(map[string]interface{})
+		decoder := json.NewDecoder(bytes.NewReader(buf))
+		decoder.UseNumber()
+		if err := decoder.Decode(&item); err != nil {
+			im.report.Total++
+			im.addError(line, err)
+			continue
+		}
+		if header == nil {
+			header = make([]string, 0, len(item))
+			for k := range item {
+				header = append(header, k)
+			}
+			if err := im.setHeader(header); err != nil {
+				return nil, err
+			}
+		}
+		values := make([]interface{}, len(header))
+		missing := make([]string, 0)
+		for i, k := range header {
+			v, ok := item[k]
+			if !ok {
+				missing = append(missing, k)
+			}
+			values[i] = v
+		}
+		if len(missing) > 0 || len(item) != len(header) {
+			extra := make([]string, 0)
+			for k := range item {
+				if !u.StringIn(header, k) {
+					extra = append(extra, k)
+				}
+			}
+			sort.Strings(missing)
+			sort.Strings(extra)
+			im.report.Total++
+			im.addError(line, fmt.Errorf("fields not match the first line, missing [%s], unexpected [%s]", strings.Join(missing, ","), strings.Join(extra, ",")))
+			continue
+		}
+		im.add(line, values)
+	}
+	if err := scanner.Err(); err != nil {
+		return im.report, err
+	}
+	im.flush()
+	return im.report, nil
+}
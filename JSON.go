@@ -0,0 +1,88 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// 字段按 JSON 读写的模式，使用 `db:",json"` 标记（解析失败时 To 返回错误），`db:",json,lenient"` 解析失败时只记录日志
+// 未标记但数据库类型为 JSON、JSONB 的字段按 lenient 处理
+const (
+	jsonNone = iota
+	jsonLenient
+	jsonStrict
+)
+
+func isJSONColumnType(typeName string) bool {
+	typeName = strings.ToUpper(typeName)
+	return typeName == "JSON" || typeName == "JSONB"
+}
+
+func isJSONTagged(field reflect.StructField) bool {
+	return hasTagOption(field.Tag.Get("db"), "json")
+}
+
+func getJSONMode(field reflect.StructField, colType string) int {
+	if isJSONTagged(field) {
+		if hasTagOption(field.Tag.Get("db"), "lenient") {
+			return jsonLenient
+		}
+		return jsonStrict
+	}
+	if !isJSONColumnType(colType) || isTimeType(field.Type) || isScannerType(field.Type) {
+		return jsonNone
+	}
+	t := field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		return jsonLenient
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return jsonLenient
+		}
+	}
+	return jsonNone
+}
+
+// 将扫描到的字符串或 []byte 解析到 target，空字符串不做处理
+func unmarshalJSONColumn(v reflect.Value, target interface{}) (bool, error) {
+	var buf []byte
+	switch value := v.Interface().(type) {
+	case string:
+		buf = []byte(value)
+	case []byte:
+		buf = value
+	default:
+		buf = []byte(v.String())
+	}
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(buf, target); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 写入时编码为 JSON 文本，nil 的指针、Map、Slice 写入 NULL
+func makeJSONValue(v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	buf, err := json.Marshal(v.Interface())
+	if err != nil {
+		// 无法编码时交给 flatArgs 处理
+		return v.Interface()
+	}
+	return string(buf)
+}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ssgo/u"
+)
+
+// 支持多个版本的密钥，加密时使用最新的版本并添加 "$版本$" 前缀，解密时根据前缀选择密钥，没有前缀的使用 SetEncryptKeys 设置的密钥
+type Keyring struct {
+	lock     sync.RWMutex
+	keys     map[string]*encryptKey
+	versions []string
+}
+
+type encryptKey struct {
+	key []byte
+	iv  []byte
+}
+
+var keyVersionMatcher = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
+var versionedCipherMatcher = regexp.MustCompile(`^\$([a-zA-Z0-9_\-.]+)\$(.+)$`)
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*encryptKey)}
+}
+
+// 添加一个版本的密钥，最后添加的版本作为当前版本用于加密
+func (kr *Keyring) Add(version string, key, iv []byte) error {
+	if !keyVersionMatcher.MatchString(version) {
+		return errors.New("bad key version: " + version)
+	}
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+	if kr.keys[version] == nil {
+		kr.versions = append(kr.versions, version)
+	} else {
+		for i, v := range kr.versions {
+			if v == version {
+				kr.versions = append(append(kr.versions[:i:i], kr.versions[i+1:]...), version)
+				break
+			}
+		}
+	}
+	kr.keys[version] = &encryptKey{key: key, iv: iv}
+	return nil
+}
+
+func (kr *Keyring) Versions() []string {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+	return append([]string{}, kr.versions...)
+}
+
+func (kr *Keyring) CurrentVersion() string {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+	if len(kr.versions) == 0 {
+		return ""
+	}
+	return kr.versions[len(kr.versions)-1]
+}
+
+func (kr *Keyring) getKey(version string) *encryptKey {
+	if version == "" {
+		return &encryptKey{key: settedKey, iv: settedIv}
+	}
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+	return kr.keys[version]
+}
+
+// 使用当前版本加密，没有添加任何版本时使用 SetEncryptKeys 的密钥并且不加前缀
+func (kr *Keyring) Encrypt(value string) string {
+	version := kr.CurrentVersion()
+	k := kr.getKey(version)
+	encrypted := u.EncryptAes(value, k.key, k.iv)
+	if version == "" {
+		return encrypted
+	}
+	return "$" + version + "$" + encrypted
+}
+
+func (kr *Keyring) Decrypt(value string) (string, error) {
+	version, encrypted := splitKeyVersion(value)
+	k := kr.getKey(version)
+	if k == nil {
+		return "", errors.New("unknown key version: " + version)
+	}
+	return decryptAes(encrypted, k.key, k.iv)
+}
+
+// 用当前版本重新加密，不能解密或已经是当前版本时返回原值和 false
+func (kr *Keyring) ReEncrypt(value string) (string, bool) {
+	version, _ := splitKeyVersion(value)
+	if version != "" && version == kr.CurrentVersion() {
+		return value, false
+	}
+	decrypted, err := kr.Decrypt(value)
+	if err != nil {
+		return value, false
+	}
+	encrypted := kr.Encrypt(decrypted)
+	return encrypted, encrypted != value
+}
+
+func splitKeyVersion(value string) (string, string) {
+	if m := versionedCipherMatcher.FindStringSubmatch(value); m != nil {
+		return m[1], m[2]
+	}
+	return "", value
+}
+
+// 与 u.DecryptAes 不同，无法解密时返回错误而不是原值
+func decryptAes(encrypted string, key, iv []byte) (string, error) {
+	encoding := base64.StdEncoding
+	if strings.ContainsAny(encrypted, "_-") {
+		encoding = base64.URLEncoding
+	}
+	buf, err := encoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(buf) == 0 || len(buf)%16 != 0 {
+		return "", errors.New("bad encrypted data")
+	}
+	out, err := u.DecryptAesBytes(buf, key, iv)
+	if err != nil {
+		return "", err
+	}
+	if len(out) == 0 || len(out) < len(buf)-16 || !utf8.Valid(out) {
+		return "", errors.New("decrypt failed")
+	}
+	return string(out), nil
+}
+
+var defaultKeyring = NewKeyring()
+var sslKeyring *Keyring
+var keyringLock = sync.RWMutex{}
+
+// 设置用于密码（未单独设置时也用于证书）的密钥
+func SetKeyring(kr *Keyring) {
+	keyringLock.Lock()
+	defaultKeyring = kr
+	keyringLock.Unlock()
+}
+
+// 为 sslCA/sslCert/sslKey 单独设置密钥
+func SetSSLKeyring(kr *Keyring) {
+	keyringLock.Lock()
+	sslKeyring = kr
+	keyringLock.Unlock()
+}
+
+func getKeyring() *Keyring {
+	keyringLock.RLock()
+	defer keyringLock.RUnlock()
+	return defaultKeyring
+}
+
+func getSSLKeyring() *Keyring {
+	keyringLock.RLock()
+	defer keyringLock.RUnlock()
+	if sslKeyring != nil {
+		return sslKeyring
+	}
+	return defaultKeyring
+}
+
+// 使用当前的密钥加密密码
+func EncryptPassword(password string) string {
+	return getKeyring().Encrypt(password)
+}
+
+// 使用当前的证书密钥加密 ca/cert/key
+func EncryptSSL(data string) string {
+	return getSSLKeyring().Encrypt(data)
+}
+
+// 将 db.json 或 dbssl.json 中加密的密码和证书用当前版本的密钥重新加密，返回修改的数量，只支持 JSON 格式的配置文件
+func ReEncryptConfigFile(file string) (int, error) {
+	if ext := strings.ToLower(filepath.Ext(file)); ext != ".json" {
+		return 0, errors.New("unsupported config format " + ext + ", only json is supported")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	out, n, err := ReEncryptConfig(data)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	return n, os.WriteFile(file, out, info.Mode())
+}
+
+// 只替换重新加密的值，保留原有的顺序和格式
+func ReEncryptConfig(data []byte) ([]byte, int, error) {
+	configs := make(map[string]interface{})
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, 0, err
+	}
+	changes := make(map[string]string)
+	for _, conf := range configs {
+		switch v := conf.(type) {
+		case string:
+			if newValue, changed := reEncryptURL(v); changed {
+				changes[v] = newValue
+			}
+		case map[string]interface{}:
+			for k, item := range v {
+				str, ok := item.(string)
+				if !ok {
+					continue
+				}
+				var kr *Keyring
+				switch strings.ToLower(k) {
+				case "password":
+					kr = getKeyring()
+				case "ca", "cert", "key", "sslca", "sslcert", "sslkey":
+					kr = getSSLKeyring()
+				default:
+					continue
+				}
+				if newValue, changed := reEncryptSecret(str, kr); changed {
+					changes[str] = newValue
+				}
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return data, 0, nil
+	}
+	out, n := replaceJSONValues(data, changes)
+	return out, n, nil
+}
+
+// 替换 JSON 中的字符串值（不包括 key），返回替换的数量
+func replaceJSONValues(data []byte, changes map[string]string) ([]byte, int) {
+	out := make([]byte, 0, len(data))
+	n := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != '"' {
+			out = append(out, data[i])
+			continue
+		}
+		end := i + 1
+		for end < len(data) && data[end] != '"' {
+			if data[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(data) {
+			return append(out, data[i:]...), n
+		}
+		literal := data[i : end+1]
+		next := end + 1
+		for next < len(data) && (data[next] == ' ' || data[next] == '\t' || data[next] == '\r' || data[next] == '\n') {
+			next++
+		}
+		value := ""
+		if next < len(data) && data[next] != ':' && json.Unmarshal(literal, &value) == nil {
+			if newValue, ok := changes[value]; ok {
+				buf := bytes.Buffer{}
+				encoder := json.NewEncoder(&buf)
+				encoder.SetEscapeHTML(false)
+				_ = encoder.Encode(newValue)
+				literal = bytes.TrimRight(buf.Bytes(), "\n")
+				n++
+			}
+		}
+		out = append(out, literal...)
+		i = end
+	}
+	return out, n
+}
+
+func reEncryptSecret(value string, kr *Keyring) (string, bool) {
+	prefix := ""
+	if strings.HasPrefix(value, "plain:") {
+		return value, false
+	} else if strings.HasPrefix(value, "aes:") {
+		prefix = "aes:"
+	} else if provider, _ := getSecretProvider(value); provider != nil {
+		// env:、file: 等不需要处理
+		return value, false
+	}
+	newValue, changed := kr.ReEncrypt(value[len(prefix):])
+	return prefix + newValue, changed
+}
+
+func reEncryptURL(setting string) (string, bool) {
+	urlInfo, err := url.Parse(setting)
+	if err != nil || !strings.Contains(setting, "://") {
+		return setting, false
+	}
+	changed := false
+	if password, ok := urlInfo.User.Password(); ok {
+		if newPassword, ok := reEncryptSecret(password, getKeyring()); ok {
+			urlInfo.User = url.UserPassword(urlInfo.User.Username(), newPassword)
+			changed = true
+		}
+	}
+	q := urlInfo.Query()
+	for _, k := range []string{"sslCA", "sslCert", "sslKey"} {
+		if v := q.Get(k); v != "" {
+			if newValue, ok := reEncryptSecret(v, getSSLKeyring()); ok {
+				q.Set(k, newValue)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return setting, false
+	}
+	urlInfo.RawQuery = q.Encode()
+	return urlInfo.String(), true
+}
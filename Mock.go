@@ -0,0 +1,730 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssgo/config"
+	"github.com/ssgo/u"
+)
+
+// 用于单元测试的模拟数据库，按 SQL 正则和参数匹配预设的请求并返回预设的数据
+type Mock struct {
+	lock         sync.Mutex
+	expectations []*MockExpectation
+}
+
+type MockExpectation struct {
+	isQuery      bool
+	sql          string
+	sqlMatcher   *regexp.Regexp
+	args         []interface{}
+	hasArgs      bool
+	columns      []string
+	types        []string
+	rows         [][]interface{}
+	lastInsertId int64
+	changes      int64
+	err          error
+	times        int
+	called       int
+}
+
+// 录制或回放使用的数据
+type MockFixture struct {
+	Exec         bool            `json:"exec,omitempty"`
+	Sql          string          `json:"sql"`
+	Args         []interface{}   `json:"args,omitempty"`
+	Columns      []string        `json:"columns,omitempty"`
+	Types        []string        `json:"types,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	LastInsertId int64           `json:"lastInsertId,omitempty"`
+	Changes      int64           `json:"changes,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+var mockSpaceMatcher = regexp.MustCompile(`\s+`)
+
+func NewMock() (*DB, *Mock) {
+	mock := &Mock{}
+	return newDriverDB(&dbInfo{Type: "mock", Host: "mock", DB: "mock"}, "\"", func(ctx context.Context) (mockBackend, error) {
+		return mock, nil
+	}), mock
+}
+
+// 使用自定义的 driver 创建 DB，用于 Mock 和 Recorder
+func newDriverDB(conf *dbInfo, quoteTag string, connect func(ctx context.Context) (mockBackend, error)) *DB {
+	conn := sql.OpenDB(&mockConnector{connect: connect})
+	pool := &dbPool{conn: conn, config: conf, rawConfig: *conf, conns: new(atomic.Int64)}
+	if conf.LogSlow == 0 {
+		conf.LogSlow = config.Duration(1000 * time.Millisecond)
+	}
+	db := &DB{QuoteTag: quoteTag, pool: pool, Config: conf, settings: newDBSettings()}
+	return db.CopyByLogger(nil)
+}
+
+func normalizeSql(requestSql string) string {
+	return strings.TrimSpace(mockSpaceMatcher.ReplaceAllString(requestSql, " "))
+}
+
+func (m *Mock) expect(isQuery bool, sqlRegex string) *MockExpectation {
+	sqlMatcher, err := regexp.Compile("(?i)" + sqlRegex)
+	if err != nil {
+		// 与 regexp.MustCompile 相同，注册时就暴露错误
+		panic("bad sql regex in mock expectation: " + err.Error())
+	}
+	e := &MockExpectation{isQuery: isQuery, sql: sqlRegex, times: 1, sqlMatcher: sqlMatcher}
+	m.lock.Lock()
+	m.expectations = append(m.expectations, e)
+	m.lock.Unlock()
+	return e
+}
+
+// 添加一个查询，sqlRegex 用于匹配去掉多余空白后的 SQL（不区分大小写），不是正确的正则表达式时 panic
+func (m *Mock) ExpectQuery(sqlRegex string) *MockExpectation {
+	return m.expect(true, sqlRegex)
+}
+
+func (m *Mock) ExpectExec(sqlRegex string) *MockExpectation {
+	return m.expect(false, sqlRegex)
+}
+
+// 检查是否所有预设的请求都已执行
+func (m *Mock) ExpectationsWereMet() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, e := range m.expectations {
+		if e.times > 0 && e.called < e.times {
+			return fmt.Errorf("expected sql not called: %s", e.sql)
+		}
+	}
+	return nil
+}
+
+// 从 Recorder 保存的文件中加载预设的请求
+func (m *Mock) LoadFixture(file string) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fixtures := make([]*MockFixture, 0)
+	decoder := json.NewDecoder(fd)
+	decoder.UseNumber()
+	if err := decoder.Decode(&fixtures); err != nil {
+		return err
+	}
+	for _, fixture := range fixtures {
+		e := m.expect(!fixture.Exec, "^"+regexp.QuoteMeta(normalizeSql(fixture.Sql))+"$")
+		e.WithArgs(fixture.Args...)
+		e.columns = fixture.Columns
+		e.types = fixture.Types
+		e.rows = fixture.Rows
+		e.lastInsertId = fixture.LastInsertId
+		e.changes = fixture.Changes
+		if fixture.Error != "" {
+			e.err = errors.New(fixture.Error)
+		}
+	}
+	return nil
+}
+
+func (m *Mock) match(isQuery bool, query string, args []driver.NamedValue) (*MockExpectation, error) {
+	query = normalizeSql(query)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, e := range m.expectations {
+		if e.isQuery != isQuery || (e.times > 0 && e.called >= e.times) || !e.sqlMatcher.MatchString(query) {
+			continue
+		}
+		if e.hasArgs && !e.matchArgs(args) {
+			continue
+		}
+		e.called++
+		return e, nil
+	}
+	return nil, fmt.Errorf("unexpected sql: %s %s", query, u.Json(namedValues(args)))
+}
+
+func (m *Mock) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := m.match(true, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return newMockRows(e.columns, e.types, e.rows), nil
+}
+
+func (m *Mock) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := m.match(false, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &mockResult{lastInsertId: e.lastInsertId, changes: e.changes}, nil
+}
+
+func (m *Mock) begin() error    { return nil }
+func (m *Mock) commit() error   { return nil }
+func (m *Mock) rollback() error { return nil }
+func (m *Mock) close() error    { return nil }
+
+// 参数按字符串比较
+func (e *MockExpectation) WithArgs(args ...interface{}) *MockExpectation {
+	e.args = args
+	e.hasArgs = true
+	return e
+}
+
+func (e *MockExpectation) matchArgs(args []driver.NamedValue) bool {
+	if len(args) != len(e.args) {
+		return false
+	}
+	for i, arg := range args {
+		expected := normalizeMockValue(e.args[i])
+		actual := normalizeMockValue(arg.Value)
+		if (expected == nil) != (actual == nil) || u.String(expected) != u.String(actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// 可以匹配的次数，0 表示不限制
+func (e *MockExpectation) Times(n int) *MockExpectation {
+	e.times = n
+	return e
+}
+
+// 使用 map 作为数据时指定字段的顺序
+func (e *MockExpectation) WithColumns(columns ...string) *MockExpectation {
+	e.columns = columns
+	return e
+}
+
+// 指定字段的数据库类型（例如 JSON、DATETIME），未指定时按值推断
+func (e *MockExpectation) WithColumnTypes(types ...string) *MockExpectation {
+	e.types = types
+	return e
+}
+
+// 返回的数据，可以是 map、结构体或者它们的数组
+func (e *MockExpectation) WillReturnRows(rows ...interface{}) *MockExpectation {
+	for _, row := range rows {
+		rowValue := reflect.ValueOf(row)
+		for rowValue.Kind() == reflect.Ptr {
+			rowValue = rowValue.Elem()
+		}
+		if rowValue.Kind() == reflect.Slice && rowValue.Type().Elem().Kind() != reflect.Interface {
+			for i := 0; i < rowValue.Len(); i++ {
+				e.addRow(rowValue.Index(i))
+			}
+		} else {
+			e.addRow(rowValue)
+		}
+	}
+	return e
+}
+
+func (e *MockExpectation) addRow(rowValue reflect.Value) {
+	for rowValue.Kind() == reflect.Ptr || rowValue.Kind() == reflect.Interface {
+		rowValue = rowValue.Elem()
+	}
+	values := make(map[string]interface{})
+	switch rowValue.Kind() {
+	case reflect.Map:
+		for _, key := range rowValue.MapKeys() {
+			values[u.String(key.Interface())] = rowValue.MapIndex(key).Interface()
+		}
+	case reflect.Struct:
+		fields := make([]string, 0)
+		flatMockStruct(rowValue, values, &fields)
+		if e.columns == nil {
+			e.columns = fields
+		}
+	case reflect.Slice:
+		if e.columns == nil {
+			return
+		}
+		row := make([]interface{}, len(e.columns))
+		for i := 0; i < rowValue.Len() && i < len(row); i++ {
+			row[i] = rowValue.Index(i).Interface()
+		}
+		e.rows = append(e.rows, row)
+		return
+	default:
+		return
+	}
+
+	if e.columns == nil {
+		e.columns = make([]string, 0, len(values))
+		for k := range values {
+			e.columns = append(e.columns, k)
+		}
+		sort.Strings(e.columns)
+	}
+	row := make([]interface{}, len(e.columns))
+	for i, column := range e.columns {
+		row[i] = values[column]
+	}
+	e.rows = append(e.rows, row)
+}
+
+func flatMockStruct(value reflect.Value, values map[string]interface{}, fields *[]string) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			flatMockStruct(value.Field(i), values, fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := u.GetLowerName(field.Name)
+		values[name] = value.Field(i).Interface()
+		*fields = append(*fields, name)
+	}
+}
+
+func (e *MockExpectation) WillReturnResult(lastInsertId, changes int64) *MockExpectation {
+	e.lastInsertId = lastInsertId
+	e.changes = changes
+	return e
+}
+
+func (e *MockExpectation) WillReturnError(err error) *MockExpectation {
+	e.err = err
+	return e
+}
+
+// 转换为 driver 支持的类型
+func normalizeMockValue(v interface{}) driver.Value {
+	if v == nil {
+		return nil
+	}
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case time.Time:
+		return value
+	case []byte:
+		return value
+	case driver.Valuer:
+		dv, err := value.Value()
+		if err != nil {
+			return nil
+		}
+		return normalizeMockValue(dv)
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	}
+	if t, ok := rv.Interface().(time.Time); ok {
+		return t
+	}
+	return u.Json(rv.Interface())
+}
+
+func namedValues(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// 录制真实数据库的请求和结果，保存后用于 Mock.LoadFixture 回放
+type Recorder struct {
+	lock     sync.Mutex
+	fixtures []*MockFixture
+	file     string
+}
+
+func NewRecorder(live *DB, file string) (*DB, *Recorder) {
+	recorder := &Recorder{file: file, fixtures: make([]*MockFixture, 0)}
+	conf := new(dbInfo)
+	*conf = *live.pool.getConfig()
+	origin := live.pool.getConn()
+	db := newDriverDB(conf, live.QuoteTag, func(ctx context.Context) (mockBackend, error) {
+		if origin == nil {
+			return nil, errors.New("operate on a bad connection")
+		}
+		conn, err := origin.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &recordConn{recorder: recorder, conn: conn}, nil
+	})
+	db.logger = &dbLogger{logger: live.logger.logger, pool: db.pool}
+	return db, recorder
+}
+
+func (r *Recorder) Fixtures() []*MockFixture {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*MockFixture{}, r.fixtures...)
+}
+
+func (r *Recorder) Save() error {
+	buf, err := json.MarshalIndent(r.Fixtures(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.file, buf, 0644)
+}
+
+func (r *Recorder) add(fixture *MockFixture) {
+	r.lock.Lock()
+	r.fixtures = append(r.fixtures, fixture)
+	r.lock.Unlock()
+}
+
+func recordValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case []byte:
+		return string(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+type recordConn struct {
+	recorder *Recorder
+	conn     *sql.Conn
+	tx       *sql.Tx
+}
+
+func (rc *recordConn) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	fixture := &MockFixture{Sql: query, Args: make([]interface{}, len(args))}
+	for i, arg := range args {
+		fixture.Args[i] = recordValue(arg.Value)
+	}
+	var rows *sql.Rows
+	var err error
+	if rc.tx != nil {
+		rows, err = rc.tx.Query(query, namedValues(args)...)
+	} else {
+		rows, err = rc.conn.QueryContext(context.Background(), query, namedValues(args)...)
+	}
+	if err != nil {
+		fixture.Error = err.Error()
+		rc.recorder.add(fixture)
+		return nil, err
+	}
+	defer rows.Close()
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range colTypes {
+		fixture.Columns = append(fixture.Columns, col.Name())
+		fixture.Types = append(fixture.Types, col.DatabaseTypeName())
+	}
+	values := make([][]interface{}, 0)
+	for rows.Next() {
+		row := make([]interface{}, len(colTypes))
+		scanValues := make([]interface{}, len(colTypes))
+		for i := range row {
+			scanValues[i] = &row[i]
+		}
+		if err := rows.Scan(scanValues...); err != nil {
+			return nil, err
+		}
+		recorded := make([]interface{}, len(row))
+		for i, v := range row {
+			recorded[i] = recordValue(v)
+		}
+		values = append(values, row)
+		fixture.Rows = append(fixture.Rows, recorded)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rc.recorder.add(fixture)
+	return newMockRows(fixture.Columns, fixture.Types, values), nil
+}
+
+func (rc *recordConn) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	fixture := &MockFixture{Exec: true, Sql: query, Args: make([]interface{}, len(args))}
+	for i, arg := range args {
+		fixture.Args[i] = recordValue(arg.Value)
+	}
+	var r sql.Result
+	var err error
+	if rc.tx != nil {
+		r, err = rc.tx.Exec(query, namedValues(args)...)
+	} else {
+		r, err = rc.conn.ExecContext(context.Background(), query, namedValues(args)...)
+	}
+	if err != nil {
+		fixture.Error = err.Error()
+		rc.recorder.add(fixture)
+		return nil, err
+	}
+	fixture.LastInsertId, _ = r.LastInsertId()
+	fixture.Changes, _ = r.RowsAffected()
+	rc.recorder.add(fixture)
+	return &mockResult{lastInsertId: fixture.LastInsertId, changes: fixture.Changes}, nil
+}
+
+func (rc *recordConn) begin() error {
+	tx, err := rc.conn.BeginTx(context.Background(), nil)
+	if err == nil {
+		rc.tx = tx
+	}
+	return err
+}
+
+func (rc *recordConn) commit() error {
+	if rc.tx == nil {
+		return sql.ErrTxDone
+	}
+	err := rc.tx.Commit()
+	rc.tx = nil
+	return err
+}
+
+func (rc *recordConn) rollback() error {
+	if rc.tx == nil {
+		return sql.ErrTxDone
+	}
+	err := rc.tx.Rollback()
+	rc.tx = nil
+	return err
+}
+
+func (rc *recordConn) close() error {
+	return rc.conn.Close()
+}
+
+// 以下为 database/sql/driver 的实现
+type mockBackend interface {
+	query(query string, args []driver.NamedValue) (driver.Rows, error)
+	exec(query string, args []driver.NamedValue) (driver.Result, error)
+	begin() error
+	commit() error
+	rollback() error
+	close() error
+}
+
+type mockDriver struct{}
+
+func (mockDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("mock driver must be used with a connector")
+}
+
+type mockConnector struct {
+	connect func(ctx context.Context) (mockBackend, error)
+}
+
+func (c *mockConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	backend, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &mockConn{backend: backend}, nil
+}
+
+func (c *mockConnector) Driver() driver.Driver {
+	return mockDriver{}
+}
+
+type mockConn struct {
+	backend mockBackend
+}
+
+func (c *mockConn) Prepare(query string) (driver.Stmt, error) {
+	return &mockStmt{conn: c, query: query}, nil
+}
+
+func (c *mockConn) Close() error {
+	return c.backend.close()
+}
+
+func (c *mockConn) Begin() (driver.Tx, error) {
+	if err := c.backend.begin(); err != nil {
+		return nil, err
+	}
+	return &mockTx{conn: c}, nil
+}
+
+func (c *mockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.backend.query(query, args)
+}
+
+func (c *mockConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.backend.exec(query, args)
+}
+
+// 接受任意类型的参数，在匹配时再转换
+func (c *mockConn) CheckNamedValue(nv *driver.NamedValue) error {
+	nv.Value = normalizeMockValue(nv.Value)
+	return nil
+}
+
+type mockTx struct {
+	conn *mockConn
+}
+
+func (tx *mockTx) Commit() error {
+	return tx.conn.backend.commit()
+}
+
+func (tx *mockTx) Rollback() error {
+	return tx.conn.backend.rollback()
+}
+
+type mockStmt struct {
+	conn  *mockConn
+	query string
+}
+
+func (s *mockStmt) Close() error {
+	return nil
+}
+
+func (s *mockStmt) NumInput() int {
+	return -1
+}
+
+func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.backend.exec(s.query, toNamedValues(args))
+}
+
+func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.backend.query(s.query, toNamedValues(args))
+}
+
+func toNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type mockResult struct {
+	lastInsertId int64
+	changes      int64
+}
+
+func (r *mockResult) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r *mockResult) RowsAffected() (int64, error) {
+	return r.changes, nil
+}
+
+type mockRows struct {
+	columns []string
+	types   []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func newMockRows(columns, types []string, rows [][]interface{}) *mockRows {
+	r := &mockRows{columns: columns, types: types, rows: make([][]driver.Value, len(rows))}
+	for i, row := range rows {
+		r.rows[i] = make([]driver.Value, len(columns))
+		for j := range columns {
+			if j < len(row) {
+				r.rows[i][j] = normalizeMockValue(row[j])
+			}
+		}
+	}
+	return r
+}
+
+func (r *mockRows) Columns() []string {
+	return r.columns
+}
+
+func (r *mockRows) Close() error {
+	return nil
+}
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func (r *mockRows) firstValue(index int) driver.Value {
+	for _, row := range r.rows {
+		if row[index] != nil {
+			return row[index]
+		}
+	}
+	return nil
+}
+
+func (r *mockRows) ColumnTypeScanType(index int) reflect.Type {
+	if v := r.firstValue(index); v != nil {
+		return reflect.TypeOf(v)
+	}
+	return reflect.TypeOf("")
+}
+
+func (r *mockRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.types) {
+		return r.types[index]
+	}
+	switch r.firstValue(index).(type) {
+	case int64:
+		return "INTEGER"
+	case float64:
+		return "REAL"
+	case bool:
+		return "BOOLEAN"
+	case []byte:
+		return "BLOB"
+	case time.Time:
+		return "DATETIME"
+	}
+	return "TEXT"
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// NameMapper 数据库字段名与结构体字段名的转换规则
+type NameMapper struct {
+	Field      func(column string) string // 数据库字段名转换为结构体字段名
+	Column     func(field string) string  // 结构体字段名转换为数据库字段名
+	IgnoreCase bool                       // 查找结构体字段时不区分大小写
+	MapKey     func(column string) string // 不为空时用于转换 MapResults 等 Map 结果中的 key
+}
+
+var (
+	// DefaultNameMapper 默认规则，读取时将首字母大写，写入时使用结构体字段名
+	DefaultNameMapper = &NameMapper{Field: upperFirst, Column: keepName}
+	// SnakeCaseMapper user_name <=> UserName
+	SnakeCaseMapper = &NameMapper{Field: snakeToCamel, Column: camelToSnake, IgnoreCase: true}
+	// CamelCaseMapper userName <=> UserName
+	CamelCaseMapper = &NameMapper{Field: upperFirst, Column: lowerFirst, IgnoreCase: true}
+	// LowerCaseMapper username <=> UserName
+	LowerCaseMapper = &NameMapper{Field: keepName, Column: strings.ToLower, IgnoreCase: true}
+)
+
+// NewNameMapper 使用自定义函数创建转换规则，column 为 nil 时写入使用结构体字段名
+func NewNameMapper(field func(column string) string, column func(field string) string) *NameMapper {
+	if column == nil {
+		column = keepName
+	}
+	return &NameMapper{Field: field, Column: column, IgnoreCase: true}
+}
+
+// SetNameMapper 设置字段名转换规则，对 To、ToKV、Map 结果以及 Insert、Replace、Update 生效，nil 恢复默认规则
+func (db *DB) SetNameMapper(mapper *NameMapper) {
+	db.settings.lock.Lock()
+	db.settings.nameMapper = mapper
+	db.settings.lock.Unlock()
+}
+
+func (settings *dbSettings) getNameMapper() *NameMapper {
+	if settings == nil {
+		return DefaultNameMapper
+	}
+	settings.lock.RLock()
+	defer settings.lock.RUnlock()
+	if settings.nameMapper == nil {
+		return DefaultNameMapper
+	}
+	return settings.nameMapper
+}
+
+func (mapper *NameMapper) columnName(field string) string {
+	if mapper == nil || mapper.Column == nil {
+		return field
+	}
+	return mapper.Column(field)
+}
+
+func (mapper *NameMapper) fieldName(column string) string {
+	if mapper == nil || mapper.Field == nil {
+		return upperFirst(column)
+	}
+	return mapper.Field(column)
+}
+
+func (mapper *NameMapper) mapKey(column string) string {
+	if mapper == nil || mapper.MapKey == nil {
+		return column
+	}
+	return mapper.MapKey(column)
+}
+
+// 查找字段对应的结构体字段，返回结构体字段名，也可以使用 `db:"name"` 设置字段名
+func (mapper *NameMapper) findField(structType reflect.Type, column string) (string, reflect.StructField, bool) {
+	name := mapper.fieldName(column)
+	if name == "" {
+		return "", reflect.StructField{}, false
+	}
+	if field, found := structType.FieldByName(name); found {
+		return name, field, true
+	}
+	if mapper != nil && mapper.IgnoreCase {
+		if field, found := structType.FieldByNameFunc(func(fieldName string) bool { return strings.EqualFold(fieldName, name) }); found {
+			return field.Name, field, true
+		}
+	}
+	// 使用 `db:"name"` 设置的字段名
+	for i := 0; i < structType.NumField(); i++ {
+		if field := structType.Field(i); field.IsExported() && strings.EqualFold(tagName(field.Tag.Get("db")), column) {
+			return field.Name, field, true
+		}
+	}
+	return name, reflect.StructField{}, false
+}
+
+func keepName(name string) string {
+	return name
+}
+
+func upperFirst(name string) string {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return name
+	}
+	return string(name[0]-32) + name[1:]
+}
+
+func lowerFirst(name string) string {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return name
+	}
+	return string(name[0]+32) + name[1:]
+}
+
+// user_name => UserName
+func snakeToCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		parts[i] = upperFirst(part)
+	}
+	return strings.Join(parts, "")
+}
+
+// UserName => user_name，连续的大写字母作为一个单词，例如 UserID => user_id
+func camelToSnake(name string) string {
+	runes := []rune(name)
+	buf := strings.Builder{}
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) && runes[i-1] != '_' {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(r))
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
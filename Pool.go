@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+// 只读节点单独的连接池设置，未设置（0）的项使用主配置
+type dbPoolSettings struct {
+	MaxOpens    int
+	MaxIdles    int
+	MaxLifeTime int
+	MaxIdleTime int
+	MinIdles    int
+}
+
+// 获得节点的连接池设置，host 为空表示主节点
+func (dbInfo *dbInfo) getPoolSettings(host string) dbPoolSettings {
+	settings := dbPoolSettings{
+		MaxOpens:    dbInfo.MaxOpens,
+		MaxIdles:    dbInfo.MaxIdles,
+		MaxLifeTime: dbInfo.MaxLifeTime,
+		MaxIdleTime: dbInfo.MaxIdleTime,
+		MinIdles:    dbInfo.MinIdles,
+	}
+	if host == "" || dbInfo.ReadonlyPools == nil {
+		return settings
+	}
+	if hostSettings := dbInfo.ReadonlyPools[host]; hostSettings != nil {
+		if hostSettings.MaxOpens > 0 {
+			settings.MaxOpens = hostSettings.MaxOpens
+		}
+		if hostSettings.MaxIdles > 0 {
+			settings.MaxIdles = hostSettings.MaxIdles
+		}
+		if hostSettings.MaxLifeTime > 0 {
+			settings.MaxLifeTime = hostSettings.MaxLifeTime
+		}
+		if hostSettings.MaxIdleTime > 0 {
+			settings.MaxIdleTime = hostSettings.MaxIdleTime
+		}
+		if hostSettings.MinIdles > 0 {
+			settings.MinIdles = hostSettings.MinIdles
+		}
+	}
+	return settings
+}
+
+// 应用连接池设置，未设置（0）的项恢复为 database/sql 的默认值，重新加载配置时可以取消之前的限制
+func applyPoolSettings(conn *sql.DB, conf *dbInfo, host string) {
+	settings := conf.getPoolSettings(host)
+	// 先设置 MaxOpens，否则 MaxIdles 会被旧的 MaxOpens 限制
+	conn.SetMaxOpenConns(settings.MaxOpens)
+	if settings.MaxIdles > 0 {
+		conn.SetMaxIdleConns(settings.MaxIdles)
+	} else {
+		conn.SetMaxIdleConns(defaultMaxIdles)
+	}
+	conn.SetConnMaxLifetime(time.Second * time.Duration(settings.MaxLifeTime))
+	conn.SetConnMaxIdleTime(time.Second * time.Duration(settings.MaxIdleTime))
+	if settings.MinIdles > 0 {
+		go warmUpPool(conn, settings.MinIdles)
+	}
+}
+
+// database/sql 默认的最大空闲连接数
+const defaultMaxIdles = 2
+
+// 预热，创建连接池或重新加载配置时预先创建 MinIdles 个连接放入空闲连接中，之后不会维持空闲连接的数量
+func warmUpPool(conn *sql.DB, minIdles int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conns := make([]*sql.Conn, 0, minIdles)
+	for i := 0; i < minIdles; i++ {
+		c, err := conn.Conn(ctx)
+		if err != nil {
+			break
+		}
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// 创建连接器，新建的每个连接都会执行 initSqls
+func makeConnector(driverName, dsn string, initSqls []string) (driver.Connector, error) {
+	tmpDB, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := tmpDB.Driver()
+	_ = tmpDB.Close()
+
+	var connector driver.Connector
+	if driverContext, ok := drv.(driver.DriverContext); ok {
+		connector, err = driverContext.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		connector = &dsnConnector{dsn: dsn, driver: drv}
+	}
+	if len(initSqls) == 0 {
+		return connector, nil
+	}
+	return &initConnector{Connector: connector, initSqls: initSqls}, nil
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type initConnector struct {
+	driver.Connector
+	initSqls []string
+}
+
+func (c *initConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, initSql := range c.initSqls {
+		if err = execOnConn(ctx, conn, initSql); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func execOnConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if stmtExecer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = stmtExecer.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return err
+}
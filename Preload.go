@@ -0,0 +1,232 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ssgo/u"
+)
+
+// Relation 结构体字段的关联关系，用于 Preload
+type Relation struct {
+	BelongsTo bool   // false 为一对多（字段为 Slice），true 为多对一（字段为结构体或其指针）
+	Table     string // 关联的表
+	Column    string // 一对多时为关联表中的外键字段，多对一时为关联表中被引用的字段，默认为 id
+	Key       string // 本表中对应的字段，一对多时默认为 id，多对一时为外键字段
+	Wheres    string // 附加的查询条件，可以带有 order by
+}
+
+// PreloadBatchSize Preload 每次 IN 查询的最大 key 数量，0 表示不分批
+var PreloadBatchSize = 500
+
+// SetRelation 为结构体字段注册关联，model 为结构体或其指针
+// 也可以在字段上标记 `db:",hasMany=orders.userId"`、`db:",belongsTo=user.id,key=userId"`
+func (db *DB) SetRelation(model interface{}, field string, rel Relation) {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	db.settings.lock.Lock()
+	if db.settings.relations == nil {
+		db.settings.relations = make(map[reflect.Type]map[string]Relation)
+	}
+	if db.settings.relations[t] == nil {
+		db.settings.relations[t] = make(map[string]Relation)
+	}
+	db.settings.relations[t][field] = rel
+	db.settings.lock.Unlock()
+}
+
+func (settings *dbSettings) getRelation(structType reflect.Type, field reflect.StructField) (Relation, bool) {
+	settings.lock.RLock()
+	rel, ok := settings.relations[structType][field.Name]
+	settings.lock.RUnlock()
+	if ok {
+		return rel, true
+	}
+
+	tag := field.Tag.Get("db")
+	if target, ok := getTagOption(tag, "hasMany"); ok {
+		rel = Relation{}
+		rel.Table, rel.Column, _ = strings.Cut(target, ".")
+	} else if target, ok := getTagOption(tag, "belongsTo"); ok {
+		rel = Relation{BelongsTo: true}
+		rel.Table, rel.Column, _ = strings.Cut(target, ".")
+	} else {
+		return rel, false
+	}
+	rel.Key, _ = getTagOption(tag, "key")
+	return rel, true
+}
+
+// 使用 SetRelation 注册的字段
+func (settings *dbSettings) hasRelation(structType reflect.Type, field string) bool {
+	if settings == nil {
+		return false
+	}
+	settings.lock.RLock()
+	defer settings.lock.RUnlock()
+	_, ok := settings.relations[structType][field]
+	return ok
+}
+
+// 标记了关联的字段不写入数据库
+func isRelationTag(tag string) bool {
+	_, hasMany := getTagOption(tag, "hasMany")
+	_, belongsTo := getTagOption(tag, "belongsTo")
+	return hasMany || belongsTo
+}
+
+// Preload 为 To 得到的结构体数组（或结构体指针）加载关联数据，每个关联按 PreloadBatchSize 分批执行 IN 查询，fields 为空时加载所有关联字段
+func (db *DB) Preload(list interface{}, fields ...string) error {
+	return preload(db.settings, db.QuoteTag, db.Select, db.logger, list, fields)
+}
+
+func (tx *Tx) Preload(list interface{}, fields ...string) error {
+	return preload(tx.settings, tx.QuoteTag, tx.Select, tx.logger, list, fields)
+}
+
+func preload(settings *dbSettings, quoteTag string, selectFunc func(string, string, ...interface{}) *QueryResult, logger *dbLogger, list interface{}, fields []string) error {
+	listValue := reflect.ValueOf(list)
+	for listValue.Kind() == reflect.Ptr {
+		listValue = listValue.Elem()
+	}
+	items := make([]reflect.Value, 0)
+	switch listValue.Kind() {
+	case reflect.Struct:
+		if !listValue.CanSet() {
+			return errors.New("preload need a pointer of struct")
+		}
+		items = append(items, listValue)
+	case reflect.Slice:
+		for i := 0; i < listValue.Len(); i++ {
+			item := listValue.Index(i)
+			for item.Kind() == reflect.Ptr && !item.IsNil() {
+				item = item.Elem()
+			}
+			if item.Kind() == reflect.Struct {
+				items = append(items, item)
+			}
+		}
+	default:
+		return errors.New("preload need a slice of struct")
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	structType := items[0].Type()
+	loaded := 0
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if len(fields) > 0 && !containsAnyFold(fields, []string{field.Name}) {
+			continue
+		}
+		rel, ok := settings.getRelation(structType, field)
+		if !ok {
+			continue
+		}
+		loaded++
+		if err := preloadRelation(settings, quoteTag, selectFunc, items, field, rel); err != nil {
+			logger.LogError(err.Error())
+			return err
+		}
+	}
+	if len(fields) > loaded {
+		err := fmt.Errorf("relation not found in %s: %s", structType.Name(), strings.Join(fields, ","))
+		logger.LogError(err.Error())
+		return err
+	}
+	return nil
+}
+
+func preloadRelation(settings *dbSettings, quoteTag string, selectFunc func(string, string, ...interface{}) *QueryResult, items []reflect.Value, field reflect.StructField, rel Relation) error {
+	if rel.BelongsTo {
+		if rel.Column == "" {
+			rel.Column = "id"
+		}
+		if rel.Key == "" {
+			return fmt.Errorf("relation %s need key", field.Name)
+		}
+		if field.Type.Kind() != reflect.Struct && (field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct) {
+			return fmt.Errorf("belongsTo field %s must be a struct or pointer of struct", field.Name)
+		}
+	} else {
+		if rel.Key == "" {
+			rel.Key = "id"
+		}
+		if rel.Column == "" {
+			return fmt.Errorf("relation %s need column", field.Name)
+		}
+		if field.Type.Kind() != reflect.Slice {
+			return fmt.Errorf("hasMany field %s must be a slice", field.Name)
+		}
+	}
+	if rel.Table == "" {
+		return fmt.Errorf("relation %s need table", field.Name)
+	}
+
+	keyFieldName, _, found := settings.getNameMapper().findField(items[0].Type(), rel.Key)
+	if !found {
+		return fmt.Errorf("key %s of relation %s not found", rel.Key, field.Name)
+	}
+
+	// 收集本表的 key，忽略零值和重复的值
+	itemKeys := make([]string, len(items))
+	args := make([]interface{}, 0, len(items))
+	seen := make(map[string]bool)
+	for i, item := range items {
+		keyValue := item.FieldByName(keyFieldName)
+		for keyValue.Kind() == reflect.Ptr && !keyValue.IsNil() {
+			keyValue = keyValue.Elem()
+		}
+		if keyValue.IsZero() {
+			continue
+		}
+		itemKeys[i] = u.String(keyValue.Interface())
+		if !seen[itemKeys[i]] {
+			seen[itemKeys[i]] = true
+			args = append(args, keyValue.Interface())
+		}
+	}
+
+	// key 较多时分批查询，每批最多 PreloadBatchSize 个
+	results := reflect.New(reflect.MapOf(reflect.TypeOf(""), field.Type))
+	batchSize := PreloadBatchSize
+	if batchSize <= 0 {
+		batchSize = len(args)
+	}
+	for start := 0; start < len(args); start += batchSize {
+		batchArgs := args[start:min(start+batchSize, len(args))]
+		wheres := appendWheres(rel.Wheres, quote(quoteTag, rel.Column)+" in "+InKeys(len(batchArgs)))
+		r := selectFunc(rel.Table, wheres, batchArgs...)
+		if r.Error != nil {
+			return r.Error
+		}
+		var err error
+		if rel.BelongsTo {
+			err = r.ToKV(results.Interface(), rel.Column)
+		} else {
+			err = r.ToGroups(results.Interface(), rel.Column)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, item := range items {
+		value := reflect.Value{}
+		if itemKeys[i] != "" && !results.Elem().IsNil() {
+			value = results.Elem().MapIndex(reflect.ValueOf(itemKeys[i]))
+		}
+		if value.IsValid() {
+			item.FieldByIndex(field.Index).Set(value)
+		} else if !rel.BelongsTo {
+			// 没有关联数据时使用空数组，表示已经加载过
+			item.FieldByIndex(field.Index).Set(reflect.MakeSlice(field.Type, 0, 0))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssgo/config"
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+// ReloadDrainTime 关闭连接池时等待正在执行的请求完成的最长时间，重新加载配置时旧连接池等待超过该时间会记录日志
+var ReloadDrainTime = 10 * time.Second
+
+// Reload 重新加载 db 配置，连接参数有变化的数据库创建新的连接池并替换（包括已经通过 GetDB 获得的实例和 DB.Config），旧连接池在正在执行的请求和事务都结束后关闭
+func Reload() error {
+	logger := log.DefaultLogger
+	configs := loadDBConfigs(logger)
+	hasSSL := false
+	dbConfigsLock.Lock()
+	for k, v := range configs {
+		dbConfigs[k] = v
+		if v.SSL != "" {
+			hasSSL = true
+		}
+	}
+	dbConfigsLock.Unlock()
+	if hasSSL {
+		loadDBSSLs()
+	}
+
+	dbInstancesLock.RLock()
+	instances := make(map[string]*DB, len(dbInstances))
+	for name, db := range dbInstances {
+		instances[name] = db
+	}
+	dbInstancesLock.RUnlock()
+
+	errs := make([]error, 0)
+	for name, db := range instances {
+		conf := configs[name]
+		if conf == nil {
+			continue
+		}
+		if err := db.pool.reload(conf, logger); err != nil {
+			logger.Error(err.Error(), "name", name)
+			errs = append(errs, fmt.Errorf("reload db %s failed: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WatchConfig 定时检查 db 配置，有变化时自动 Reload，返回停止检查的函数
+func WatchConfig(interval time.Duration) func() {
+	stopChan := make(chan bool)
+	lastConfigs := u.Json(loadDBConfigs(log.DefaultLogger))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if configs := u.Json(loadDBConfigs(log.DefaultLogger)); configs != lastConfigs {
+					lastConfigs = configs
+					_ = Reload()
+				}
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stopChan)
+	}
+}
+
+func (pool *dbPool) reload(rawConf *dbInfo, logger *log.Logger) error {
+	pool.lock.RLock()
+	oldRawConf := pool.rawConfig
+	pool.lock.RUnlock()
+
+	if sameConnection(&oldRawConf, rawConf) {
+		if samePoolSettings(&oldRawConf, rawConf) {
+			return nil
+		}
+
+		// 只修改连接池设置
+		pool.lock.Lock()
+		conf := new(dbInfo)
+		*conf = *pool.config
+		conf.MaxOpens = rawConf.MaxOpens
+		conf.MaxIdles = rawConf.MaxIdles
+		conf.MaxLifeTime = rawConf.MaxLifeTime
+		conf.LogSlow = rawConf.LogSlow
+		if conf.LogSlow == 0 {
+			conf.LogSlow = config.Duration(1000 * time.Millisecond)
+		}
+		conf.MaxIdleTime = rawConf.MaxIdleTime
+		conf.MinIdles = rawConf.MinIdles
+		conf.ReadonlyPools = rawConf.ReadonlyPools
+		applyPoolSettings(pool.conn, conf, "")
+		for i, conn := range pool.readonlyConnections {
+			applyPoolSettings(conn, conf, pool.readonlyHosts[i])
+		}
+		*pool.config = *conf
+		pool.rawConfig = *rawConf
+		pool.lock.Unlock()
+		return nil
+	}
+
+	newPool, err := openPool(rawConf, logger)
+	if err == nil {
+		err = newPool.conn.Ping()
+	}
+	if err != nil {
+		closePools(newPool.conn, newPool.readonlyConnections)
+		newPool.runCleanup()
+		return err
+	}
+
+	// 已经 Prepare 的 Stmt 在新连接池中重新创建
+	pool.lock.RLock()
+	stmts := make([]*Stmt, 0, len(pool.stmts))
+	for stmt := range pool.stmts {
+		stmts = append(stmts, stmt)
+	}
+	pool.lock.RUnlock()
+	newStmts := make(map[*Stmt]*sql.Stmt, len(stmts))
+	for _, stmt := range stmts {
+		newStmt, err := newPool.conn.Prepare(*stmt.lastSql)
+		if err != nil {
+			logger.Error(err.Error(), "sql", *stmt.lastSql)
+			continue
+		}
+		newStmts[stmt] = newStmt
+	}
+
+	pool.lock.Lock()
+	oldConn := pool.conn
+	oldReadonlyConnections := pool.readonlyConnections
+	pool.conn = newPool.conn
+	pool.readonlyConnections = newPool.readonlyConnections
+	pool.readonlyHosts = newPool.readonlyHosts
+	*pool.config = *newPool.config
+	pool.rawConfig = newPool.rawConfig
+	// 新的请求计入新的计数，旧连接在旧计数归零后关闭
+	oldConns := pool.conns
+	pool.conns = new(atomic.Int64)
+	oldCleanup := pool.cleanup
+	pool.cleanup = newPool.cleanup
+	oldStmts := make([]*sql.Stmt, 0, len(newStmts))
+	for stmt, newStmt := range newStmts {
+		if pool.stmts[stmt] {
+			oldStmts = append(oldStmts, stmt.conn)
+			stmt.conn = newStmt
+		} else {
+			// 期间已经关闭
+			_ = newStmt.Close()
+		}
+	}
+	pool.lock.Unlock()
+
+	go func() {
+		startTime := time.Now()
+		logged := false
+		for oldConns.Load() > 0 {
+			if !logged && time.Since(startTime) > ReloadDrainTime {
+				logger.Warning("old db pool is still in use after reload", "host", oldRawConf.Host, "active", oldConns.Load())
+				logged = true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, oldStmt := range oldStmts {
+			_ = oldStmt.Close()
+		}
+		closePools(oldConn, oldReadonlyConnections)
+		if oldCleanup != nil {
+			oldCleanup()
+		}
+	}()
+	return nil
+}
+
+func closePools(conn *sql.DB, readonlyConnections []*sql.DB) {
+	if conn != nil {
+		_ = conn.Close()
+	}
+	for _, readonlyConn := range readonlyConnections {
+		_ = readonlyConn.Close()
+	}
+}
+
+func sameConnection(a, b *dbInfo) bool {
+	return a.Type == b.Type && a.User == b.User && a.Password == b.Password && a.Host == b.Host &&
+		strings.Join(a.ReadonlyHosts, ",") == strings.Join(b.ReadonlyHosts, ",") &&
+		a.DB == b.DB && a.SSL == b.SSL && a.Args == b.Args && strings.Join(a.InitSqls, ";") == strings.Join(b.InitSqls, ";")
+}
+
+func samePoolSettings(a, b *dbInfo) bool {
+	return a.MaxOpens == b.MaxOpens && a.MaxIdles == b.MaxIdles && a.MaxLifeTime == b.MaxLifeTime &&
+		a.MaxIdleTime == b.MaxIdleTime && a.MinIdles == b.MinIdles && a.LogSlow == b.LogSlow &&
+		u.Json(a.ReadonlyPools) == u.Json(b.ReadonlyPools)
+}
@@ -7,20 +7,22 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
-	"time"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/ssgo/u"
 )
 
 type QueryResult struct {
-	rows      *sql.Rows
-	Sql       *string
-	Args      []interface{}
-	Error     error
-	logger    *dbLogger
-	usedTime  float32
-	completed bool
+	rows       *sql.Rows
+	settings   *dbSettings
+	valueIndex int // 结果为单个值时使用的列
+	onRow      func(scanValues []interface{})
+	Sql        *string
+	Args       []interface{}
+	Error      error
+	logger     *dbLogger
+	usedTime   float32
+	completed  bool
+	use        *poolUse // 不为空时 rows 关闭后结束连接池中的活动请求
 }
 
 type ExecResult struct {
@@ -63,6 +65,14 @@ func (r *QueryResult) Complete() {
 		}
 		r.completed = true
 	}
+	r.releasePool()
+}
+
+func (r *QueryResult) releasePool() {
+	if r.use != nil {
+		r.use.release()
+		r.use = nil
+	}
 }
 
 func (r *QueryResult) To(result interface{}) error {
@@ -72,6 +82,7 @@ func (r *QueryResult) To(result interface{}) error {
 	return r.makeResults(result, r.rows)
 }
 
+// DECIMAL、NUMERIC 字段的值为 Decimal
 func (r *QueryResult) MapResults() []map[string]interface{} {
 	result := make([]map[string]interface{}, 0)
 	err := r.makeResults(&result, r.rows)
@@ -180,92 +191,27 @@ func (r *QueryResult) StringOnR1C1() string {
 	return result
 }
 
-func (r *QueryResult) ToKV(target interface{}) error {
-	v := reflect.ValueOf(target)
-	t := v.Type()
-	for t.Kind() == reflect.Ptr {
-		v = v.Elem()
-		t = v.Type()
-	}
-
-	if t.Kind() != reflect.Map {
-		r.logger.LogQueryError("target not a map", *r.Sql, r.Args, r.usedTime)
-		return errors.New("target not a map")
-	}
-
-	vt := t.Elem()
-	finalVt := vt
-	for finalVt.Kind() == reflect.Ptr {
-		finalVt = finalVt.Elem()
+// ToKV 按 keyColumn（默认为第一列）生成 key，值的转换与 To 相同，Map 或结构体的值合并到已有的值中（只修改查询结果中有的字段），相同的 key 后面的数据合并到前面
+// 需要整体替换相同 key 的值时使用 ToTree
+func (r *QueryResult) ToKV(target interface{}, keyColumn ...string) error {
+	if r.rows == nil {
+		return errors.New("operate on a bad query")
 	}
-	if finalVt.Kind() == reflect.Map || finalVt.Kind() == reflect.Struct {
+	if len(keyColumn) == 0 {
 		colTypes, err := r.getColumnTypes()
-		list := r.MapResults()
 		if err != nil {
+			r.Complete()
 			r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
 			return err
-		} else {
-			for _, item := range list {
-				newKey := reflect.ValueOf(reflect.New(t.Key()).Interface()).Elem()
-				u.Convert(item[colTypes[0].Name()], newKey)
-
-				newValue := v.MapIndex(newKey)
-				isNew := false
-				if !newValue.IsValid() {
-					newValue = reflect.New(vt)
-					isNew = true
-				}
-
-				err := mapstructure.WeakDecode(item, newValue.Interface())
-				if err != nil {
-					r.logger.LogError(err.Error())
-				}
-
-				if isNew {
-					v.SetMapIndex(newKey, newValue.Elem())
-				}
-			}
-		}
-	} else {
-		list := r.SliceResults()
-		for _, item := range list {
-			if len(item) < 2 {
-				continue
-			}
-			switch vt.Kind() {
-			case reflect.Int:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(u.Int(item[1])))
-			case reflect.Int8:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(int8(u.Int(item[1]))))
-			case reflect.Int16:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(int16(u.Int(item[1]))))
-			case reflect.Int32:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(int32(u.Int(item[1]))))
-			case reflect.Int64:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(u.Int64(item[1])))
-			case reflect.Uint:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(uint(u.Int(item[1]))))
-			case reflect.Uint8:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(uint8(u.Int(item[1]))))
-			case reflect.Uint16:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(uint16(u.Int(item[1]))))
-			case reflect.Uint32:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(uint32(u.Int(item[1]))))
-			case reflect.Uint64:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(uint64(u.Int64(item[1]))))
-			case reflect.Float32:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(u.Float(item[1])))
-			case reflect.Float64:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(u.Float64(item[1])))
-			case reflect.Bool:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(u.Bool(item[1])))
-			case reflect.String:
-				v.SetMapIndex(reflect.ValueOf(u.String(item[0])), reflect.ValueOf(u.String(item[1])))
-			}
 		}
+		keyColumn = []string{colTypes[0].Name()}
 	}
-
-	return nil
+	err := r.makeTree(target, keyColumn[:1], true)
+	if err != nil {
+		r.Complete()
+		r.logger.LogQueryError(err.Error(), *r.Sql, r.Args, r.usedTime)
+	}
+	return err
 }
 
 func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
@@ -276,6 +222,7 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 	defer func() {
 		_ = rows.Close()
 		r.completed = true
+		r.releasePool()
 	}()
 	resultsValue := reflect.ValueOf(results)
 	if resultsValue.Kind() != reflect.Ptr {
@@ -294,6 +241,11 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 	}
 
 	colNum := len(colTypes)
+	// 只取一列时使用的列
+	valueIndex := 0
+	if r.valueIndex > 0 && r.valueIndex < colNum {
+		valueIndex = r.valueIndex
+	}
 	originRowType := rowType
 	if rowType.Kind() == reflect.Slice {
 		// 处理数组类型，非数组类型表示只取一行数据
@@ -305,14 +257,39 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 	}
 
 	scanValues := make([]interface{}, colNum)
-	if rowType.Kind() == reflect.Struct {
+	mapper := r.settings.getNameMapper()
+	mapKeys := make([]string, colNum)
+	for colIndex, col := range colTypes {
+		mapKeys[colIndex] = mapper.mapKey(col.Name())
+	}
+	// 实现了 sql.Scanner 的字段直接由驱动扫描
+	scanners := make([]bool, colNum)
+	// 按 JSON 解析的字段
+	jsonModes := make([]int, colNum)
+	// interface{} 类型的目标中 DECIMAL 字段转换为 Decimal
+	decimals := make([]bool, colNum)
+	// 实现了 sql.Scanner 的类型（例如 Decimal）只取一列，由驱动直接扫描
+	isScanner := isScannerType(rowType)
+	if isScanner {
+		for colIndex := 0; colIndex < colNum; colIndex++ {
+			scanValues[colIndex] = makeValue(nil)
+		}
+		scanValues[valueIndex] = reflect.New(originRowType).Interface()
+	} else if rowType.Kind() == reflect.Struct && !isTimeType(rowType) {
 		// 按结构处理数据
 		for colIndex, col := range colTypes {
-			publicColName := makePublicVarName(col.Name())
-			field, found := rowType.FieldByName(publicColName)
+			_, field, found := mapper.findField(rowType, col.Name())
 			if found {
-				if field.Type.Kind() == reflect.Interface {
+				if jsonModes[colIndex] = getJSONMode(field, col.DatabaseTypeName()); jsonModes[colIndex] != jsonNone {
+					scanValues[colIndex] = makeValue(nil)
+				} else if field.Type.Kind() == reflect.Interface && getColumnKind(col.DatabaseTypeName()) == columnKindDecimal {
+					scanValues[colIndex] = new(interface{})
+					decimals[colIndex] = true
+				} else if field.Type.Kind() == reflect.Interface || isTimeType(field.Type) {
 					scanValues[colIndex] = makeValue(colTypes[colIndex].ScanType())
+				} else if isScannerType(field.Type) {
+					scanValues[colIndex] = reflect.New(field.Type).Interface()
+					scanners[colIndex] = true
 				} else {
 					scanValues[colIndex] = makeValue(field.Type)
 				}
@@ -323,8 +300,17 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 	} else if rowType.Kind() == reflect.Map {
 		// 按Map处理数据
 		for colIndex := range colTypes {
-			if rowType.Elem().Kind() == reflect.Interface {
+			if rowType.Elem().Kind() == reflect.Interface && isJSONColumnType(colTypes[colIndex].DatabaseTypeName()) {
+				scanValues[colIndex] = makeValue(nil)
+				jsonModes[colIndex] = jsonLenient
+			} else if rowType.Elem().Kind() == reflect.Interface && getColumnKind(colTypes[colIndex].DatabaseTypeName()) == columnKindDecimal {
+				scanValues[colIndex] = new(interface{})
+				decimals[colIndex] = true
+			} else if rowType.Elem().Kind() == reflect.Interface {
 				scanValues[colIndex] = makeValue(colTypes[colIndex].ScanType())
+			} else if isScannerType(rowType.Elem()) {
+				scanValues[colIndex] = reflect.New(rowType.Elem()).Interface()
+				scanners[colIndex] = true
 			} else {
 				scanValues[colIndex] = makeValue(rowType.Elem())
 			}
@@ -332,7 +318,10 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 	} else if rowType.Kind() == reflect.Slice {
 		// 按Map处理数据
 		for colIndex := range colTypes {
-			if rowType.Elem().Kind() == reflect.Interface {
+			if rowType.Elem().Kind() == reflect.Interface && getColumnKind(colTypes[colIndex].DatabaseTypeName()) == columnKindDecimal {
+				scanValues[colIndex] = new(interface{})
+				decimals[colIndex] = true
+			} else if rowType.Elem().Kind() == reflect.Interface {
 				scanValues[colIndex] = makeValue(colTypes[colIndex].ScanType())
 			} else {
 				scanValues[colIndex] = makeValue(rowType.Elem())
@@ -340,13 +329,15 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 		}
 	} else {
 		// 只返回一列结果
+		for colIndex := 0; colIndex < colNum; colIndex++ {
+			scanValues[colIndex] = makeValue(nil)
+		}
 		if rowType.Kind() == reflect.Interface {
-			scanValues[0] = makeValue(colTypes[0].ScanType())
+			scanValues[valueIndex] = makeValue(colTypes[valueIndex].ScanType())
+		} else if isTimeType(rowType) {
+			scanValues[valueIndex] = new(interface{})
 		} else {
-			scanValues[0] = makeValue(rowType)
-		}
-		for colIndex := 1; colIndex < colNum; colIndex++ {
-			scanValues[colIndex] = makeValue(nil)
+			scanValues[valueIndex] = makeValue(rowType)
 		}
 	}
 
@@ -358,7 +349,15 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 		if err != nil {
 			return err
 		}
-		if rowType.Kind() == reflect.Struct {
+		r.logger.countBytesScanned(scannedBytes(scanValues))
+		if r.onRow != nil {
+			r.onRow(scanValues)
+		}
+		if isScanner {
+			// 复制扫描的值，指针类型时 NULL 为 nil
+			data = reflect.New(originRowType).Elem()
+			data.Set(reflect.ValueOf(scanValues[valueIndex]).Elem())
+		} else if rowType.Kind() == reflect.Struct && !isTimeType(rowType) {
 			if resultsValue.Kind() == reflect.Slice {
 				data = reflect.New(rowType).Elem()
 			} else {
@@ -367,22 +366,38 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 			}
 
 			for colIndex, col := range colTypes {
-				publicColName := makePublicVarName(col.Name())
-				field, found := rowType.FieldByName(publicColName)
+				publicColName, field, found := mapper.findField(rowType, col.Name())
 				//fmt.Println("=====1", publicColName, found)
-				if found {
+				if found && scanners[colIndex] {
+					data.FieldByName(publicColName).Set(reflect.ValueOf(scanValues[colIndex]).Elem())
+				} else if found && decimals[colIndex] {
+					if valuePtr := reflect.ValueOf(scanValues[colIndex]).Elem(); !valuePtr.IsNil() {
+						data.FieldByName(publicColName).Set(makeDecimalValue(valuePtr.Elem()))
+					}
+				} else if found && jsonModes[colIndex] != jsonNone {
+					valuePtr := reflect.ValueOf(scanValues[colIndex]).Elem()
+					if !valuePtr.IsNil() {
+						target := reflect.New(field.Type)
+						if ok, err := unmarshalJSONColumn(valuePtr.Elem(), target.Interface()); err != nil {
+							if jsonModes[colIndex] == jsonStrict {
+								return fmt.Errorf("column %s: %w", col.Name(), err)
+							}
+							r.logger.LogError(fmt.Sprintf("column %s: %s", col.Name(), err.Error()))
+						} else if ok {
+							data.FieldByName(publicColName).Set(target.Elem())
+						}
+					}
+				} else if found {
 					valuePtr := reflect.ValueOf(scanValues[colIndex]).Elem()
 					if !valuePtr.IsNil() {
 						// fmt.Println("=====2", field.Type.String(), valuePtr.String(), valuePtr.Elem().Kind(), data.FieldByName(publicColName).Kind(), valuePtr.Elem().Interface())
-						if field.Type.String() == "time.Time" {
+						if isTimeType(field.Type) {
 							// 转换时间
-							tm, err := time.Parse("2006-01-02 15:04:05.000000", valuePtr.Elem().String())
+							tm, err := r.settings.parseTime(valuePtr.Elem().Interface(), getColumnKind(col.DatabaseTypeName()) == columnKindInt)
 							if err != nil {
-								tm, err = time.Parse("2006-01-02 15:04:05", valuePtr.Elem().String())
-							}
-							if err == nil {
-								data.FieldByName(publicColName).Set(reflect.ValueOf(tm))
+								return fmt.Errorf("column %s: %w", col.Name(), err)
 							}
+							setTimeValue(data.FieldByName(publicColName), tm)
 						} else if valuePtr.Elem().Kind() != data.FieldByName(publicColName).Kind() && data.FieldByName(publicColName).Kind() != reflect.Interface {
 							if data.FieldByName(publicColName).Kind() == reflect.Ptr {
 								//fmt.Println("=====9", data.FieldByName(publicColName).Type().Elem().Kind())
@@ -474,12 +489,28 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 				isNew = false
 			}
 			for colIndex, col := range colTypes {
+				mapKey := reflect.ValueOf(mapKeys[colIndex])
 				valuePtr := reflect.ValueOf(scanValues[colIndex]).Elem()
-				if !valuePtr.IsNil() {
+				if scanners[colIndex] {
+					data.SetMapIndex(mapKey, valuePtr)
+				} else if jsonModes[colIndex] != jsonNone && !valuePtr.IsNil() {
+					// JSON 类型的字段解析为 map、slice，无法解析时保留字符串
+					var decoded interface{}
+					if ok, err := unmarshalJSONColumn(valuePtr.Elem(), &decoded); ok {
+						data.SetMapIndex(mapKey, reflect.ValueOf(&decoded).Elem())
+					} else {
+						if err != nil {
+							r.logger.LogError(fmt.Sprintf("column %s: %s", col.Name(), err.Error()))
+						}
+						data.SetMapIndex(mapKey, valuePtr.Elem())
+					}
+				} else if decimals[colIndex] && !valuePtr.IsNil() {
+					data.SetMapIndex(mapKey, makeDecimalValue(valuePtr.Elem()))
+				} else if !valuePtr.IsNil() {
 					// fmt.Println("=====2", col.Name(), col.DatabaseTypeName(), valuePtr.Elem().Kind(), valuePtr.Elem().Interface())
-					data.SetMapIndex(reflect.ValueOf(col.Name()), fixValue(col.DatabaseTypeName(), valuePtr.Elem()))
+					data.SetMapIndex(mapKey, fixValue(col.DatabaseTypeName(), valuePtr.Elem()))
 				} else {
-					data.SetMapIndex(reflect.ValueOf(col.Name()), fixValue(col.DatabaseTypeName(), reflect.New(rowType.Elem()).Elem()))
+					data.SetMapIndex(mapKey, fixValue(col.DatabaseTypeName(), reflect.New(rowType.Elem()).Elem()))
 				}
 			}
 		} else if rowType.Kind() == reflect.Slice {
@@ -487,7 +518,9 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 			data = reflect.MakeSlice(rowType, colNum, colNum)
 			for colIndex, col := range colTypes {
 				valuePtr := reflect.ValueOf(scanValues[colIndex]).Elem()
-				if !valuePtr.IsNil() {
+				if decimals[colIndex] && !valuePtr.IsNil() {
+					data.Index(colIndex).Set(makeDecimalValue(valuePtr.Elem()))
+				} else if !valuePtr.IsNil() {
 					data.Index(colIndex).Set(fixValue(col.DatabaseTypeName(), valuePtr.Elem()))
 				} else {
 					data.Index(colIndex).Set(fixValue(col.DatabaseTypeName(), reflect.New(rowType.Elem()).Elem()))
@@ -495,14 +528,26 @@ func (r *QueryResult) makeResults(results interface{}, rows *sql.Rows) error {
 			}
 		} else {
 			// 只返回一列结果
-			valuePtr := reflect.ValueOf(scanValues[0]).Elem()
-			if !valuePtr.IsNil() {
-				data = fixValue(colTypes[0].DatabaseTypeName(), valuePtr.Elem())
+			valuePtr := reflect.ValueOf(scanValues[valueIndex]).Elem()
+			if isTimeType(rowType) {
+				data = reflect.New(rowType).Elem()
+				if !valuePtr.IsNil() {
+					tm, err := r.settings.parseTime(valuePtr.Elem().Interface(), getColumnKind(colTypes[valueIndex].DatabaseTypeName()) == columnKindInt)
+					if err != nil {
+						return fmt.Errorf("column %s: %w", colTypes[valueIndex].Name(), err)
+					}
+					setTimeValue(data, tm)
+				}
+			} else if !valuePtr.IsNil() {
+				data = fixValue(colTypes[valueIndex].DatabaseTypeName(), valuePtr.Elem())
+			} else if resultsValue.Kind() == reflect.Slice {
+				// NULL 使用零值
+				data = reflect.New(rowType).Elem()
 			}
 		}
 
 		if resultsValue.Kind() == reflect.Slice {
-			if originRowType.Kind() == reflect.Ptr {
+			if originRowType.Kind() == reflect.Ptr && !isScanner {
 				resultsValue = reflect.Append(resultsValue, data.Addr())
 			} else {
 				resultsValue = reflect.Append(resultsValue, data)
@@ -558,14 +603,14 @@ func (r *QueryResult) getColumnTypes() ([]*sql.ColumnType, error) {
 	return r.rows.ColumnTypes()
 }
 
-func makePublicVarName(name string) string {
-	colNameBytes := []byte(name)
-	if colNameBytes[0] >= 97 {
-		colNameBytes[0] -= 32
-		return string(colNameBytes)
-	} else {
-		return name
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// 类型或类型的指针实现了 sql.Scanner，指针类型的字段在 NULL 时为 nil
+func isScannerType(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PointerTo(t)
 	}
+	return t.Implements(scannerType)
 }
 
 func makeValue(t reflect.Type) interface{} {
@@ -3,29 +3,231 @@ package db
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"github.com/go-sql-driver/mysql"
-	log "github.com/ssgo/log"
 )
 
-func RegisterSSL(name, ca, cert, key string, insecure bool) {
-	caPool := x509.NewCertPool()
-	clientCert := make([]tls.Certificate, 0, 1)
-	if caPool.AppendCertsFromPEM([]byte(ca)) {
-		certs, err := tls.X509KeyPair([]byte(cert), []byte(key))
-		if err == nil {
-			clientCert = append(clientCert, certs)
-			err = mysql.RegisterTLSConfig(name, &tls.Config{
-				Certificates:       clientCert,
-				RootCAs:            caPool,
-				InsecureSkipVerify: insecure,
-			})
-			if err != nil {
-				log.DefaultLogger.Error(err.Error())
-			}
-		} else {
-			log.DefaultLogger.Error(err.Error())
+// CA、Cert、Key 可以是 PEM 内容或者 PEM 文件的路径
+type SSLConfig struct {
+	CA         string
+	Cert       string
+	Key        string
+	Insecure   bool
+	ServerName string
+	MinVersion string // 1.0、1.1、1.2、1.3
+}
+
+// 将注册的 tls 配置应用到某种数据库驱动，返回需要加入连接参数的内容
+type TLSDialect func(name string, ssl *SSLConfig, tlsConfig *tls.Config) (string, error)
+
+// 内置的方式可以返回 cleanup，在连接池关闭时调用（例如删除临时文件）
+type tlsDialect func(name string, ssl *SSLConfig, tlsConfig *tls.Config) (string, func(), error)
+
+type registeredSSL struct {
+	conf      *SSLConfig
+	tlsConfig *tls.Config
+}
+
+var sslConfigs = make(map[string]*registeredSSL)
+var sslConfigsLock = sync.RWMutex{}
+
+var tlsDialects = map[string]tlsDialect{
+	"mysql":      mysqlTLSDialect,
+	"postgres":   postgresTLSDialect,
+	"postgresql": postgresTLSDialect,
+	"pgx":        postgresTLSDialect,
+}
+var tlsDialectsLock = sync.RWMutex{}
+
+func RegisterSSL(name, ca, cert, key string, insecure bool) error {
+	return RegisterSSLConfig(name, &SSLConfig{CA: ca, Cert: cert, Key: key, Insecure: insecure})
+}
+
+func RegisterSSLConfig(name string, conf *SSLConfig) error {
+	tlsConfig, err := makeTLSConfig(conf)
+	if err != nil {
+		return err
+	}
+	// mysql 驱动需要提前注册
+	if err = mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return err
+	}
+	sslConfigsLock.Lock()
+	sslConfigs[name] = &registeredSSL{conf: conf, tlsConfig: tlsConfig}
+	sslConfigsLock.Unlock()
+	return nil
+}
+
+// 获得注册的 tls 配置，可用于自行创建连接
+func GetTLSConfig(name string) *tls.Config {
+	sslConfigsLock.RLock()
+	defer sslConfigsLock.RUnlock()
+	if ssl := sslConfigs[name]; ssl != nil {
+		return ssl.tlsConfig.Clone()
+	}
+	return nil
+}
+
+// 注册其他数据库类型使用 tls 的方式
+func RegisterTLSDialect(dbType string, dialect TLSDialect) {
+	tlsDialectsLock.Lock()
+	if dialect == nil {
+		delete(tlsDialects, dbType)
+	} else {
+		tlsDialects[dbType] = func(name string, ssl *SSLConfig, tlsConfig *tls.Config) (string, func(), error) {
+			args, err := dialect(name, ssl, tlsConfig)
+			return args, nil, err
+		}
+	}
+	tlsDialectsLock.Unlock()
+}
+
+// 生成连接参数，未注册的名称直接交给驱动处理（mysql 为 tls=true、skip-verify 等，postgres 为 sslmode=require 等）
+func makeTLSArgs(dbType, name string) (string, func(), error) {
+	sslConfigsLock.RLock()
+	ssl := sslConfigs[name]
+	sslConfigsLock.RUnlock()
+	if ssl == nil {
+		if dbType == "mysql" {
+			return "tls=" + name, nil, nil
 		}
+		if isPostgres(dbType) {
+			return "sslmode=" + name, nil, nil
+		}
+		return "", nil, errors.New("ssl " + name + " is not registered")
+	}
+	tlsDialectsLock.RLock()
+	dialect := tlsDialects[dbType]
+	tlsDialectsLock.RUnlock()
+	if dialect == nil {
+		return "", nil, errors.New("ssl is not supported for " + dbType)
+	}
+	return dialect(name, ssl.conf, ssl.tlsConfig)
+}
+
+func makeTLSConfig(conf *SSLConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.Insecure, ServerName: conf.ServerName}
+	if conf.CA != "" {
+		ca, err := readPEM(conf.CA)
+		if err != nil {
+			return nil, fmt.Errorf("ca: %w", err)
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("ca error for db")
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	if conf.Cert != "" || conf.Key != "" {
+		cert, err := readPEM(conf.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("cert: %w", err)
+		}
+		key, err := readPEM(conf.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key: %w", err)
+		}
+		clientCert, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	if conf.MinVersion != "" {
+		version, err := parseTLSVersion(conf.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.MinVersion = version
+	}
+	return tlsConfig, nil
+}
+
+func isPEM(value string) bool {
+	return strings.Contains(value, "-----BEGIN")
+}
+
+func readPEM(value string) ([]byte, error) {
+	if isPEM(value) {
+		return []byte(value), nil
+	}
+	if value == "" {
+		return nil, errors.New("empty pem")
+	}
+	return os.ReadFile(value)
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(version), "TLS") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.New("bad tls version: " + version)
+}
+
+func isPostgres(dbType string) bool {
+	return dbType == "postgres" || dbType == "postgresql" || dbType == "pgx"
+}
+
+func mysqlTLSDialect(name string, ssl *SSLConfig, tlsConfig *tls.Config) (string, func(), error) {
+	return "tls=" + name, nil, nil
+}
+
+// postgres 驱动只支持文件，PEM 内容写入只有当前用户可以访问的临时目录，连接池关闭时删除
+func postgresTLSDialect(name string, ssl *SSLConfig, tlsConfig *tls.Config) (string, func(), error) {
+	if ssl.ServerName != "" {
+		return "", nil, errors.New("ssl server name is not supported for postgres, use the host name instead")
+	}
+	if ssl.MinVersion != "" {
+		// 驱动默认最低为 TLS 1.2
+		if version, err := parseTLSVersion(ssl.MinVersion); err != nil || version > tls.VersionTLS12 {
+			return "", nil, errors.New("ssl min version " + ssl.MinVersion + " is not supported for postgres")
+		}
+	}
+
+	args := make([]string, 0)
+	if ssl.Insecure {
+		args = append(args, "sslmode=require")
 	} else {
-		log.DefaultLogger.Error("ca error for db")
+		args = append(args, "sslmode=verify-full")
+	}
+	dir := ""
+	cleanup := func() {
+		if dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+	}
+	for _, item := range []struct{ arg, value, ext string }{{"sslrootcert", ssl.CA, "ca"}, {"sslcert", ssl.Cert, "cert"}, {"sslkey", ssl.Key, "key"}} {
+		if item.value == "" {
+			continue
+		}
+		file := item.value
+		if isPEM(item.value) {
+			if dir == "" {
+				var err error
+				if dir, err = os.MkdirTemp("", "ssgo-db-ssl-"); err != nil {
+					return "", nil, err
+				}
+			}
+			file = filepath.Join(dir, item.ext+".pem")
+			if err := os.WriteFile(file, []byte(item.value), 0600); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+		}
+		args = append(args, item.arg+"="+file)
 	}
+	return strings.Join(args, "&"), cleanup, nil
 }
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+)
+
+type TableColumn struct {
+	Name     string
+	Type     string // 数据库中的类型，例如 VARCHAR、INTEGER、DECIMAL
+	Nullable bool
+}
+
+// 获得表的字段信息，通过查询空结果的字段类型实现，适用于所有数据库
+func (db *DB) TableColumns(table string) ([]*TableColumn, error) {
+	r := db.Query("select * from " + db.Quote(table) + " where 1=0")
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	defer r.Complete()
+	colTypes, err := r.getColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]*TableColumn, len(colTypes))
+	for i, col := range colTypes {
+		nullable, ok := col.Nullable()
+		columns[i] = &TableColumn{Name: col.Name(), Type: strings.ToUpper(col.DatabaseTypeName()), Nullable: nullable || !ok}
+	}
+	return columns, nil
+}
+
+const (
+	columnKindString = iota
+	columnKindInt
+	columnKindFloat
+	columnKindDecimal
+	columnKindBool
+)
+
+// INT、INTEGER、BIGINT、INT8、UNSIGNED BIG INT 等，不包括 POINT、INTERVAL
+var intTypeMatcher = regexp.MustCompile(`\b(TINY|SMALL|MEDIUM|BIG)?INT(EGER|\d+)?\b`)
+
+func getColumnKind(typeName string) int {
+	typeName = strings.ToUpper(typeName)
+	switch {
+	case intTypeMatcher.MatchString(typeName):
+		return columnKindInt
+	case strings.Contains(typeName, "DEC") || strings.Contains(typeName, "NUMERIC"):
+		return columnKindDecimal
+	case strings.Contains(typeName, "REAL") || strings.Contains(typeName, "FLOA") || strings.Contains(typeName, "DOUB"):
+		return columnKindFloat
+	case strings.Contains(typeName, "BOOL"):
+		return columnKindBool
+	}
+	return columnKindString
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 解析配置中的密码、证书等敏感信息，value 为去掉 "scheme:" 前缀后的内容
+type SecretProvider interface {
+	Resolve(value string) (string, error)
+}
+
+type SecretProviderFunc func(value string) (string, error)
+
+func (f SecretProviderFunc) Resolve(value string) (string, error) {
+	return f(value)
+}
+
+var secretProviders = map[string]SecretProvider{
+	"env":  SecretProviderFunc(resolveEnvSecret),
+	"file": SecretProviderFunc(resolveFileSecret),
+}
+var secretProvidersLock = sync.RWMutex{}
+var secretSchemeMatcher = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_\-]*):`)
+
+// 注册自定义的解析方式，配置中使用 "scheme:value"
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersLock.Lock()
+	if provider == nil {
+		delete(secretProviders, scheme)
+	} else {
+		secretProviders[scheme] = provider
+	}
+	secretProvidersLock.Unlock()
+}
+
+func getSecretProvider(value string) (SecretProvider, string) {
+	m := secretSchemeMatcher.FindStringSubmatch(value)
+	if m == nil {
+		return nil, ""
+	}
+	secretProvidersLock.RLock()
+	provider := secretProviders[m[1]]
+	secretProvidersLock.RUnlock()
+	if provider == nil {
+		return nil, ""
+	}
+	return provider, m[1]
+}
+
+// 解析 "env:DB_PASS"、"file:/run/secrets/db"、"aes:..." 等格式，没有前缀时兼容旧的 AES 加密格式，无法解密则使用原始值
+// 以 "plain:" 开头的值去掉前缀后原样使用，用于本身以 "file:"、"env:" 等开头的明文密码
+func ResolveSecret(value string) (string, error) {
+	resolved, _, err := resolveSecret(value, getKeyring())
+	return resolved, err
+}
+
+// aes: 使用 Keyring 解密，第二个返回值为 false 表示无法解密而使用了原始值
+func resolveSecret(value string, kr *Keyring) (string, bool, error) {
+	if strings.HasPrefix(value, "plain:") {
+		return value[6:], true, nil
+	}
+	if strings.HasPrefix(value, "aes:") {
+		decrypted, err := kr.Decrypt(value[4:])
+		if err != nil {
+			return "", false, fmt.Errorf("resolve aes secret failed: %w", err)
+		}
+		return decrypted, true, nil
+	}
+	if provider, scheme := getSecretProvider(value); provider != nil {
+		resolved, err := provider.Resolve(value[len(scheme)+1:])
+		if err != nil {
+			return "", false, fmt.Errorf("resolve %s secret failed: %w", scheme, err)
+		}
+		return resolved, true, nil
+	}
+	if decrypted, err := kr.Decrypt(value); err == nil {
+		return decrypted, true, nil
+	}
+	return value, false, nil
+}
+
+func resolveEnvSecret(value string) (string, error) {
+	if v, ok := os.LookupEnv(value); ok {
+		return v, nil
+	}
+	return "", errors.New("env " + value + " not exists")
+}
+
+func resolveFileSecret(value string) (string, error) {
+	buf, err := os.ReadFile(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf), "\r\n"), nil
+}
@@ -0,0 +1,426 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+type ShardStrategy int
+
+const (
+	ShardByMod   ShardStrategy = iota // 分片键取模
+	ShardByHash                       // 分片键 crc32 后取模
+	ShardByRange                      // 按 Ranges 划分区间
+)
+
+// ShardConfig 分表设置，物理表按顺序平均分布在 DBs 中
+type ShardConfig struct {
+	Table       string        // 逻辑表名
+	DBs         []string      // GetDB 使用的数据库名称
+	Tables      int           // 物理表数量
+	Strategy    ShardStrategy // 路由策略
+	Ranges      []int64       // ShardByRange 时每个物理表分片键的上限（不包含）
+	TableFormat string        // 物理表名格式，默认为 %s_%02d
+}
+
+type ShardRouter struct {
+	conf ShardConfig
+	dbs  []*DB
+}
+
+// ShardMergeOption 跨分片查询时合并结果的排序和数量限制
+type ShardMergeOption struct {
+	OrderBy string
+	Desc    bool
+	Limit   int
+}
+
+// ShardResult 跨分片查询的结果，数据只能读取一次，MapResults 的结果会被缓存
+type ShardResult struct {
+	shards  []*QueryResult
+	merge   *ShardMergeOption
+	results []map[string]interface{}
+	read    bool
+	logger  *dbLogger
+	Error   error
+}
+
+func NewShardRouter(conf ShardConfig, logger *log.Logger) (*ShardRouter, error) {
+	if conf.Table == "" || len(conf.DBs) == 0 {
+		return nil, errors.New("shard table or dbs not set")
+	}
+	if conf.Tables <= 0 {
+		conf.Tables = len(conf.DBs)
+	}
+	if conf.Strategy == ShardByRange && len(conf.Ranges) != conf.Tables {
+		return nil, fmt.Errorf("shard ranges must have %d items", conf.Tables)
+	}
+	if conf.TableFormat == "" {
+		conf.TableFormat = "%s_%02d"
+	}
+
+	router := &ShardRouter{conf: conf, dbs: make([]*DB, len(conf.DBs))}
+	for i, name := range conf.DBs {
+		db := GetDB(name, logger)
+		if db == nil {
+			return nil, fmt.Errorf("db config not exists: %s", name)
+		}
+		if db.Error != nil {
+			return nil, db.Error
+		}
+		router.dbs[i] = db
+	}
+	return router, nil
+}
+
+// Shards 物理表的数量
+func (router *ShardRouter) Shards() int {
+	return router.conf.Tables
+}
+
+// Route 根据分片键返回物理表序号
+func (router *ShardRouter) Route(shardKey interface{}) (int, error) {
+	n := router.conf.Tables
+	switch router.conf.Strategy {
+	case ShardByHash:
+		return int(crc32.ChecksumIEEE([]byte(u.String(shardKey))) % uint32(n)), nil
+	case ShardByRange:
+		key, err := shardInt(shardKey)
+		if err != nil {
+			return -1, err
+		}
+		for i, upper := range router.conf.Ranges {
+			if key < upper {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("shard key %d out of range", key)
+	default:
+		key, err := shardInt(shardKey)
+		if err != nil {
+			return -1, err
+		}
+		key %= int64(n)
+		if key < 0 {
+			key += int64(n)
+		}
+		return int(key), nil
+	}
+}
+
+// 取模和区间路由的分片键必须是整数或整数字符串
+func shardInt(shardKey interface{}) (int64, error) {
+	v := reflect.ValueOf(shardKey)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.String:
+		if key, err := strconv.ParseInt(strings.TrimSpace(v.String()), 10, 64); err == nil {
+			return key, nil
+		}
+	}
+	return 0, fmt.Errorf("shard key %v is not an integer", shardKey)
+}
+
+// Shard 返回物理表所在的数据库和物理表名
+func (router *ShardRouter) Shard(index int) (*DB, string) {
+	db := router.dbs[index*len(router.dbs)/router.conf.Tables]
+	return db, fmt.Sprintf(router.conf.TableFormat, router.conf.Table, index)
+}
+
+// Table 根据分片键返回数据库和物理表名
+func (router *ShardRouter) Table(shardKey interface{}) (*DB, string, error) {
+	index, err := router.Route(shardKey)
+	if err != nil {
+		return nil, "", err
+	}
+	db, table := router.Shard(index)
+	return db, table, nil
+}
+
+func (router *ShardRouter) Insert(shardKey interface{}, data interface{}) *ExecResult {
+	db, table, err := router.Table(shardKey)
+	if err != nil {
+		return &ExecResult{Error: err}
+	}
+	return db.Insert(table, data)
+}
+
+func (router *ShardRouter) Replace(shardKey interface{}, data interface{}) *ExecResult {
+	db, table, err := router.Table(shardKey)
+	if err != nil {
+		return &ExecResult{Error: err}
+	}
+	return db.Replace(table, data)
+}
+
+func (router *ShardRouter) Update(shardKey interface{}, data interface{}, wheres string, args ...interface{}) *ExecResult {
+	db, table, err := router.Table(shardKey)
+	if err != nil {
+		return &ExecResult{Error: err}
+	}
+	return db.Update(table, data, wheres, args...)
+}
+
+func (router *ShardRouter) Delete(shardKey interface{}, wheres string, args ...interface{}) *ExecResult {
+	db, table, err := router.Table(shardKey)
+	if err != nil {
+		return &ExecResult{Error: err}
+	}
+	return db.Delete(table, wheres, args...)
+}
+
+func (router *ShardRouter) Select(shardKey interface{}, wheres string, args ...interface{}) *QueryResult {
+	db, table, err := router.Table(shardKey)
+	if err != nil {
+		return &QueryResult{Error: err}
+	}
+	return db.Select(table, wheres, args...)
+}
+
+// Query 在分片键对应的物理表上查询，requestSql 中的 {table} 替换为物理表名
+func (router *ShardRouter) Query(shardKey interface{}, requestSql string, args ...interface{}) *QueryResult {
+	db, table, err := router.Table(shardKey)
+	if err != nil {
+		return &QueryResult{Error: err}
+	}
+	return db.Query(strings.ReplaceAll(requestSql, "{table}", db.Quote(table)), args...)
+}
+
+// SelectAll 并行查询所有分片并合并结果，设置了 Limit 时每个分片只查询前 Limit 条数据
+func (router *ShardRouter) SelectAll(wheres string, merge *ShardMergeOption, args ...interface{}) *ShardResult {
+	return router.queryAll(func(db *DB, table string) *QueryResult {
+		tail := merge.shardTail(db.QuoteTag)
+		if tail == "" || findWheresTail(wheres) == -1 {
+			return db.Select(table, strings.TrimSpace(wheres+tail), args...)
+		}
+		// 已经带有 order by、limit 时使用子查询
+		requestSql := makeSelectSql(db.QuoteTag, table, db.settings.makeSoftDeleteWheres(db.QuoteTag, table, wheres, db.softDeleteMode))
+		return db.Query(merge.wrapSql(db.QuoteTag, requestSql), args...)
+	}, merge)
+}
+
+// QueryAll 并行在所有分片上查询并合并结果，requestSql 中的 {table} 替换为物理表名，设置了 Limit 时使用子查询限制每个分片的数量
+func (router *ShardRouter) QueryAll(requestSql string, merge *ShardMergeOption, args ...interface{}) *ShardResult {
+	return router.queryAll(func(db *DB, table string) *QueryResult {
+		return db.Query(merge.wrapSql(db.QuoteTag, strings.ReplaceAll(requestSql, "{table}", db.Quote(table))), args...)
+	}, merge)
+}
+
+// 每个分片查询时附加的 order by、limit
+func (merge *ShardMergeOption) shardTail(quoteTag string) string {
+	if merge == nil || merge.Limit <= 0 {
+		return ""
+	}
+	tail := ""
+	if merge.OrderBy != "" {
+		tail = " order by " + quote(quoteTag, merge.OrderBy) + u.StringIf(merge.Desc, " desc", "")
+	}
+	return fmt.Sprintf("%s limit %d", tail, merge.Limit)
+}
+
+func (merge *ShardMergeOption) wrapSql(quoteTag string, requestSql string) string {
+	tail := merge.shardTail(quoteTag)
+	if tail == "" {
+		return requestSql
+	}
+	return fmt.Sprintf("select * from (%s) %s%s", requestSql, quote(quoteTag, "shardResult"), tail)
+}
+
+func (router *ShardRouter) queryAll(query func(db *DB, table string) *QueryResult, merge *ShardMergeOption) *ShardResult {
+	n := router.conf.Tables
+	shards := make([]*QueryResult, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			db, table := router.Shard(index)
+			shards[index] = query(db, table)
+		}(i)
+	}
+	wg.Wait()
+
+	result := &ShardResult{shards: shards, merge: merge, logger: router.dbs[0].logger}
+	for _, r := range shards {
+		if r.Error != nil && result.Error == nil {
+			result.Error = r.Error
+		}
+	}
+	if result.Error != nil {
+		result.complete()
+	}
+	return result
+}
+
+func (r *ShardResult) complete() {
+	for _, shard := range r.shards {
+		shard.Complete()
+	}
+}
+
+// MapResults 的结果会被缓存，可以多次调用
+func (r *ShardResult) MapResults() []map[string]interface{} {
+	if r.results == nil {
+		results := make([]map[string]interface{}, 0)
+		_ = r.To(&results)
+		r.results = results
+	}
+	return r.results
+}
+
+// To 与 QueryResult.To 使用相同的规则转换每个分片的数据，再按 ShardMergeOption 合并，result 为数组的指针
+// 每个分片的数据只能读取一次，再次调用时只能得到 MapResults 缓存的结果
+func (r *ShardResult) To(result interface{}) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	if cached, ok := result.(*[]map[string]interface{}); ok && r.results != nil {
+		*cached = append(make([]map[string]interface{}, 0, len(r.results)), r.results...)
+		return nil
+	}
+	err := r.to(result)
+	if err != nil {
+		r.logger.LogError(err.Error())
+	}
+	return err
+}
+
+func (r *ShardResult) to(result interface{}) error {
+	if r.read {
+		return errors.New("shard result already read")
+	}
+	r.read = true
+	resultValue := reflect.ValueOf(result)
+	if resultValue.Kind() != reflect.Ptr || resultValue.Elem().Kind() != reflect.Slice {
+		r.complete()
+		return errors.New("result not a pointer of slice")
+	}
+	sliceType := resultValue.Elem().Type()
+
+	orderBy := ""
+	if r.merge != nil {
+		orderBy = r.merge.OrderBy
+	}
+	shardItems := make([]reflect.Value, len(r.shards))
+	shardKeys := make([][]interface{}, len(r.shards))
+	shardErrors := make([]error, len(r.shards))
+	wg := sync.WaitGroup{}
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func(index int, shard *QueryResult) {
+			defer wg.Done()
+			if orderBy != "" {
+				colTypes, err := shard.getColumnTypes()
+				if err != nil {
+					shard.Complete()
+					shardErrors[index] = err
+					return
+				}
+				orderIndex := -1
+				for colIndex, col := range colTypes {
+					if strings.EqualFold(col.Name(), orderBy) {
+						orderIndex = colIndex
+						break
+					}
+				}
+				if orderIndex == -1 {
+					shard.Complete()
+					shardErrors[index] = fmt.Errorf("order column %s not found", orderBy)
+					return
+				}
+				// 记录每行用于排序的值
+				shard.onRow = func(scanValues []interface{}) {
+					shardKeys[index] = append(shardKeys[index], scannedValue(scanValues[orderIndex]))
+				}
+			}
+			list := reflect.New(sliceType)
+			shardErrors[index] = shard.makeResults(list.Interface(), shard.rows)
+			shardItems[index] = list.Elem()
+		}(i, shard)
+	}
+	wg.Wait()
+	for _, err := range shardErrors {
+		if err != nil {
+			return err
+		}
+	}
+
+	type mergeItem struct {
+		value reflect.Value
+		key   interface{}
+	}
+	items := make([]mergeItem, 0)
+	for i, list := range shardItems {
+		for j := 0; j < list.Len(); j++ {
+			item := mergeItem{value: list.Index(j)}
+			if orderBy != "" {
+				item.key = shardKeys[i][j]
+			}
+			items = append(items, item)
+		}
+	}
+	if orderBy != "" {
+		sort.SliceStable(items, func(i, j int) bool {
+			c := compareValue(items[i].key, items[j].key)
+			if r.merge.Desc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+	if r.merge != nil && r.merge.Limit > 0 && len(items) > r.merge.Limit {
+		items = items[:r.merge.Limit]
+	}
+
+	merged := reflect.MakeSlice(sliceType, 0, len(items))
+	for _, item := range items {
+		merged = reflect.Append(merged, item.value)
+	}
+	resultValue.Elem().Set(merged)
+	return nil
+}
+
+func compareValue(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if isNumber(a) && isNumber(b) {
+		fa, fb := u.Float64(a), u.Float64(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(u.String(a), u.String(b))
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
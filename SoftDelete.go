@@ -0,0 +1,183 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	softDeleteDefault = iota
+	softDeleteWith
+	softDeleteOnly
+)
+
+var wheresTailMatcher = regexp.MustCompile(`(?i)(^|\s+)(group\s+by|having|order\s+by|limit)\s`)
+
+// 查找 group by、having、order by、limit 等尾部子句的位置，忽略引号和括号中的内容，没有时返回 -1
+func findWheresTail(wheres string) int {
+	masked := []byte(wheres)
+	var quoteChar byte
+	depth := 0
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		switch {
+		case quoteChar != 0:
+			if c == '\\' && i+1 < len(masked) {
+				masked[i] = '_'
+				i++
+			} else if c == quoteChar {
+				quoteChar = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quoteChar = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				continue
+			}
+		}
+		masked[i] = '_'
+	}
+	if pos := wheresTailMatcher.FindIndex(masked); pos != nil {
+		return pos[0]
+	}
+	return -1
+}
+
+// SetSoftDelete 为表注册软删除字段，Delete 将改为设置该字段为当前时间，Update、Select 自动过滤已删除的数据
+func (db *DB) SetSoftDelete(table, column string) {
+	db.settings.lock.Lock()
+	if column == "" {
+		delete(db.settings.softDeletes, table)
+	} else {
+		db.settings.softDeletes[table] = column
+	}
+	db.settings.lock.Unlock()
+}
+
+// WithDeleted 返回包含已删除数据的操作实例，Delete 时直接删除数据
+func (db *DB) WithDeleted() *DB {
+	newDB := db.CopyByLogger(db.logger.logger)
+	newDB.softDeleteMode = softDeleteWith
+	return newDB
+}
+
+// OnlyDeleted 返回只操作已删除数据的操作实例，Delete 时彻底删除已经软删除的数据
+func (db *DB) OnlyDeleted() *DB {
+	newDB := db.CopyByLogger(db.logger.logger)
+	newDB.softDeleteMode = softDeleteOnly
+	return newDB
+}
+
+// Restore 恢复软删除的数据
+func (db *DB) Restore(table string, wheres string, args ...interface{}) *ExecResult {
+	requestSql, values, err := db.settings.makeRestoreSql(db.QuoteTag, table, wheres, args)
+	if err != nil {
+		db.logger.LogError(err.Error())
+		return &ExecResult{Sql: &requestSql, Args: args, logger: db.logger, Error: err}
+	}
+	return db.Exec(requestSql, values...)
+}
+
+func (tx *Tx) Restore(table string, wheres string, args ...interface{}) *ExecResult {
+	requestSql, values, err := tx.settings.makeRestoreSql(tx.QuoteTag, table, wheres, args)
+	if err != nil {
+		tx.logger.LogError(err.Error())
+		return &ExecResult{Sql: &requestSql, Args: args, logger: tx.logger, Error: err}
+	}
+	return tx.Exec(requestSql, values...)
+}
+
+// Select 按条件查询表中的数据，已注册软删除的表自动过滤已删除的数据
+func (db *DB) Select(table string, wheres string, args ...interface{}) *QueryResult {
+	wheres = db.settings.makeSoftDeleteWheres(db.QuoteTag, table, wheres, db.softDeleteMode)
+	return db.Query(makeSelectSql(db.QuoteTag, table, wheres), args...)
+}
+
+func (tx *Tx) Select(table string, wheres string, args ...interface{}) *QueryResult {
+	wheres = tx.settings.makeSoftDeleteWheres(tx.QuoteTag, table, wheres, tx.softDeleteMode)
+	return tx.Query(makeSelectSql(tx.QuoteTag, table, wheres), args...)
+}
+
+func makeSelectSql(quoteTag string, table string, wheres string) string {
+	return fmt.Sprintf("select * from %s%s", quote(quoteTag, table), makeWheresClause(wheres))
+}
+
+// 生成 where 子句，条件为空时只保留 order by、limit 等尾部子句
+func makeWheresClause(wheres string) string {
+	wheres = strings.TrimSpace(wheres)
+	if wheres == "" {
+		return ""
+	}
+	if findWheresTail(wheres) == 0 {
+		return " " + wheres
+	}
+	return " where " + wheres
+}
+
+func (settings *dbSettings) softDeleteColumn(table string) string {
+	if settings == nil {
+		return ""
+	}
+	settings.lock.RLock()
+	defer settings.lock.RUnlock()
+	return settings.softDeletes[table]
+}
+
+func (settings *dbSettings) makeSoftDeleteWheres(quoteTag string, table string, wheres string, mode int) string {
+	column := settings.softDeleteColumn(table)
+	if column == "" || mode == softDeleteWith {
+		return wheres
+	}
+	if mode == softDeleteOnly {
+		return appendWheres(wheres, quote(quoteTag, column)+" is not null")
+	}
+	return appendWheres(wheres, quote(quoteTag, column)+" is null")
+}
+
+func (settings *dbSettings) makeDeleteSql(quoteTag string, table string, wheres string, mode int, args []interface{}) (string, []interface{}) {
+	// WithDeleted 时直接删除，OnlyDeleted 时只删除已经软删除的数据
+	column := settings.softDeleteColumn(table)
+	if column == "" || mode != softDeleteDefault {
+		wheres = settings.makeSoftDeleteWheres(quoteTag, table, wheres, mode)
+		return fmt.Sprintf("delete from %s%s", quote(quoteTag, table), makeWheresClause(wheres)), args
+	}
+
+	// 软删除
+	wheres = settings.makeSoftDeleteWheres(quoteTag, table, wheres, mode)
+	timeConf := settings.getTimeConfig()
+	values := append([]interface{}{timeConf.now().Format(timeConf.writeLayout())}, args...)
+	return fmt.Sprintf("update %s set %s=?%s", quote(quoteTag, table), quote(quoteTag, column), makeWheresClause(wheres)), values
+}
+
+func (settings *dbSettings) makeRestoreSql(quoteTag string, table string, wheres string, args []interface{}) (string, []interface{}, error) {
+	column := settings.softDeleteColumn(table)
+	if column == "" {
+		return "", args, errors.New("soft delete not set for table " + table)
+	}
+	wheres = settings.makeSoftDeleteWheres(quoteTag, table, wheres, softDeleteOnly)
+	return fmt.Sprintf("update %s set %s=NULL%s", quote(quoteTag, table), quote(quoteTag, column), makeWheresClause(wheres)), args, nil
+}
+
+// 将条件追加到 where 中，保留 group by、having、order by、limit 等尾部子句
+func appendWheres(wheres string, condition string) string {
+	if wheres == "" {
+		return condition
+	}
+	tail := ""
+	if pos := findWheresTail(wheres); pos != -1 {
+		tail = " " + strings.TrimSpace(wheres[pos:])
+		wheres = wheres[:pos]
+	}
+	if wheres == "" {
+		return condition + tail
+	}
+	return "(" + wheres + ") and " + condition + tail
+}
@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssgo/u"
+)
+
+type dbStats struct {
+	queries      atomic.Int64
+	errors       atomic.Int64
+	slowQueries  atomic.Int64
+	bytesScanned atomic.Int64
+}
+
+// PoolStats 单个连接池的状态
+type PoolStats struct {
+	Host     string
+	Readonly bool
+	sql.DBStats
+}
+
+// DBStats 数据库实例的连接池状态和请求计数
+type DBStats struct {
+	Name         string
+	Type         string
+	Pools        []PoolStats
+	Queries      int64
+	Errors       int64
+	SlowQueries  int64
+	BytesScanned int64
+}
+
+func (dl *dbLogger) countQuery() {
+	if dl != nil && dl.pool != nil {
+		dl.pool.stats.queries.Add(1)
+	}
+}
+
+func (dl *dbLogger) countError() {
+	if dl != nil && dl.pool != nil {
+		dl.pool.stats.errors.Add(1)
+	}
+}
+
+func (dl *dbLogger) countSlowQuery() {
+	if dl != nil && dl.pool != nil {
+		dl.pool.stats.slowQueries.Add(1)
+	}
+}
+
+func (dl *dbLogger) countBytesScanned(n int64) {
+	if dl != nil && dl.pool != nil {
+		dl.pool.stats.bytesScanned.Add(n)
+	}
+}
+
+// 估算 Scan 得到的数据大小
+func scannedBytes(scanValues []interface{}) int64 {
+	var n int64
+	for _, scanValue := range scanValues {
+		v := reflect.ValueOf(scanValue)
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				break
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.String, reflect.Slice:
+			n += int64(v.Len())
+		case reflect.Ptr, reflect.Interface, reflect.Invalid:
+		default:
+			n += int64(v.Type().Size())
+		}
+	}
+	return n
+}
+
+func (pool *dbPool) getReadonlyHosts() ([]*sql.DB, []string) {
+	if pool == nil {
+		return nil, nil
+	}
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	return pool.readonlyConnections, pool.readonlyHosts
+}
+
+// Ping 检查主节点和所有只读节点的连接
+func (db *DB) Ping(ctx context.Context) error {
+	conn, _, conf := db.pool.get()
+	readonlyConnections, readonlyHosts := db.pool.getReadonlyHosts()
+	if conn == nil {
+		return errors.New("operate on a bad connection")
+	}
+	errs := make([]error, 0)
+	if err := conn.PingContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", conf.Host, err))
+	}
+	for i, readonlyConn := range readonlyConnections {
+		if err := readonlyConn.PingContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", readonlyHosts[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats 获得所有连接池的状态以及请求计数
+func (db *DB) Stats() *DBStats {
+	conn, _, conf := db.pool.get()
+	readonlyConnections, readonlyHosts := db.pool.getReadonlyHosts()
+	stats := &DBStats{Name: db.displayName(), Type: conf.Type, Pools: make([]PoolStats, 0, len(readonlyConnections)+1)}
+	if conn != nil {
+		stats.Pools = append(stats.Pools, PoolStats{Host: conf.Host, DBStats: conn.Stats()})
+	}
+	for i, readonlyConn := range readonlyConnections {
+		stats.Pools = append(stats.Pools, PoolStats{Host: readonlyHosts[i], Readonly: true, DBStats: readonlyConn.Stats()})
+	}
+	if db.pool != nil {
+		stats.Queries = db.pool.stats.queries.Load()
+		stats.Errors = db.pool.stats.errors.Load()
+		stats.SlowQueries = db.pool.stats.slowQueries.Load()
+		stats.BytesScanned = db.pool.stats.bytesScanned.Load()
+	}
+	return stats
+}
+
+// 使用 URL 配置的实例名称中可能包含密码，只显示类型、地址和库名
+func (db *DB) displayName() string {
+	if !strings.Contains(db.name, "://") {
+		return db.name
+	}
+	conf := db.pool.getConfig()
+	if isFileDB(conf.Type) {
+		return fmt.Sprintf("%s://%s", conf.Type, conf.Host)
+	}
+	return fmt.Sprintf("%s://%s/%s", conf.Type, conf.Host, conf.DB)
+}
+
+// AllStats 获得所有数据库实例的状态
+func AllStats() []*DBStats {
+	dbInstancesLock.RLock()
+	names := make([]string, 0, len(dbInstances))
+	for name := range dbInstances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dbs := make([]*DB, len(names))
+	for i, name := range names {
+		dbs[i] = dbInstances[name]
+	}
+	dbInstancesLock.RUnlock()
+
+	list := make([]*DBStats, len(dbs))
+	for i, db := range dbs {
+		list[i] = db.Stats()
+	}
+	return list
+}
+
+type healthHandler struct {
+	pingTimeout time.Duration
+}
+
+// NewHealthHandler 以 JSON（默认）或 Prometheus 文本格式（?format=prometheus）输出所有数据库实例的状态，有节点无法连接时返回 503
+func NewHealthHandler(pingTimeout time.Duration) http.Handler {
+	if pingTimeout <= 0 {
+		pingTimeout = 3 * time.Second
+	}
+	return &healthHandler{pingTimeout: pingTimeout}
+}
+
+type dbHealth struct {
+	*DBStats
+	Ok    bool
+	Error string `json:",omitempty"`
+}
+
+func (handler *healthHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), handler.pingTimeout)
+	defer cancel()
+
+	dbInstancesLock.RLock()
+	dbs := make([]*DB, 0, len(dbInstances))
+	for _, db := range dbInstances {
+		dbs = append(dbs, db)
+	}
+	dbInstancesLock.RUnlock()
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].name < dbs[j].name })
+
+	list := make([]dbHealth, len(dbs))
+	allOk := true
+	for i, db := range dbs {
+		list[i] = dbHealth{DBStats: db.Stats(), Ok: true}
+		if err := db.Ping(ctx); err != nil {
+			list[i].Ok = false
+			list[i].Error = err.Error()
+			allOk = false
+		}
+	}
+
+	status := http.StatusOK
+	if !allOk {
+		status = http.StatusServiceUnavailable
+	}
+	if request.URL.Query().Get("format") == "prometheus" {
+		response.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		response.WriteHeader(status)
+		_, _ = response.Write([]byte(makePrometheusText(list)))
+		return
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.WriteHeader(status)
+	_, _ = response.Write(u.JsonBytes(list))
+}
+
+func makePrometheusText(list []dbHealth) string {
+	out := &strings.Builder{}
+	writeMetric := func(name, help, typ string, value func(item dbHealth) float64) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, item := range list {
+			fmt.Fprintf(out, "%s{db=\"%s\"} %v\n", name, escapeLabel(item.Name), value(item))
+		}
+	}
+	writePoolMetric := func(name, help, typ string, value func(stats sql.DBStats) float64) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, item := range list {
+			for _, pool := range item.Pools {
+				fmt.Fprintf(out, "%s{db=\"%s\",host=\"%s\",readonly=\"%t\"} %v\n", name, escapeLabel(item.Name), escapeLabel(pool.Host), pool.Readonly, value(pool.DBStats))
+			}
+		}
+	}
+
+	writeMetric("ssgo_db_up", "Whether all pools of the db respond to ping.", "gauge", func(item dbHealth) float64 {
+		if item.Ok {
+			return 1
+		}
+		return 0
+	})
+	writeMetric("ssgo_db_queries_total", "Number of executed queries.", "counter", func(item dbHealth) float64 { return float64(item.Queries) })
+	writeMetric("ssgo_db_errors_total", "Number of logged errors.", "counter", func(item dbHealth) float64 { return float64(item.Errors) })
+	writeMetric("ssgo_db_slow_queries_total", "Number of slow queries.", "counter", func(item dbHealth) float64 { return float64(item.SlowQueries) })
+	writeMetric("ssgo_db_bytes_scanned_total", "Approximate bytes scanned from query results.", "counter", func(item dbHealth) float64 { return float64(item.BytesScanned) })
+	writePoolMetric("ssgo_db_max_open_connections", "Maximum number of open connections.", "gauge", func(stats sql.DBStats) float64 { return float64(stats.MaxOpenConnections) })
+	writePoolMetric("ssgo_db_open_connections", "Number of established connections.", "gauge", func(stats sql.DBStats) float64 { return float64(stats.OpenConnections) })
+	writePoolMetric("ssgo_db_in_use_connections", "Number of connections currently in use.", "gauge", func(stats sql.DBStats) float64 { return float64(stats.InUse) })
+	writePoolMetric("ssgo_db_idle_connections", "Number of idle connections.", "gauge", func(stats sql.DBStats) float64 { return float64(stats.Idle) })
+	writePoolMetric("ssgo_db_wait_count_total", "Number of connections waited for.", "counter", func(stats sql.DBStats) float64 { return float64(stats.WaitCount) })
+	writePoolMetric("ssgo_db_wait_duration_seconds_total", "Time blocked waiting for a new connection.", "counter", func(stats sql.DBStats) float64 { return stats.WaitDuration.Seconds() })
+	writePoolMetric("ssgo_db_max_idle_closed_total", "Connections closed due to max idle connections.", "counter", func(stats sql.DBStats) float64 { return float64(stats.MaxIdleClosed) })
+	writePoolMetric("ssgo_db_max_idle_time_closed_total", "Connections closed due to max idle time.", "counter", func(stats sql.DBStats) float64 { return float64(stats.MaxIdleTimeClosed) })
+	writePoolMetric("ssgo_db_max_lifetime_closed_total", "Connections closed due to max lifetime.", "counter", func(stats sql.DBStats) float64 { return float64(stats.MaxLifetimeClosed) })
+	return out.String()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
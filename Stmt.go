@@ -13,16 +13,27 @@ type Stmt struct {
 	lastArgs []interface{}
 	Error    error
 	logger *dbLogger
+	pool     *dbPool
+	settings *dbSettings
 }
 
 func (stmt *Stmt) Exec(args ...interface{}) *ExecResult {
+	args = stmt.settings.makeTimeArgs(args)
 	stmt.lastArgs = args
-	if stmt.conn == nil {
+	use, err := stmt.pool.acquire()
+	if err != nil {
+		return &ExecResult{Sql: stmt.lastSql, Args: stmt.lastArgs, usedTime: -1, logger: stmt.logger, Error: err}
+	}
+	conn := stmt.getConn()
+	if conn == nil {
+		use.release()
 		return &ExecResult{Sql: stmt.lastSql, Args: stmt.lastArgs, usedTime: -1, logger: stmt.logger, Error: errors.New("operate on a bad connection")}
 	}
 	startTime := time.Now()
-	r, err := stmt.conn.Exec(args...)
+	r, err := conn.Exec(args...)
+	use.release()
 	endTime := time.Now()
+	stmt.logger.countQuery()
 	if err != nil {
 		//logError(err, stmt.lastSql, stmt.lastArgs)
 		stmt.logger.LogQueryError(err.Error(), *stmt.lastSql, stmt.lastArgs, log.MakeUesdTime(startTime, endTime))
@@ -31,11 +42,24 @@ func (stmt *Stmt) Exec(args ...interface{}) *ExecResult {
 	return &ExecResult{Sql: stmt.lastSql, Args: stmt.lastArgs, usedTime: log.MakeUesdTime(startTime, endTime), logger: stmt.logger, result: r}
 }
 
+// 重新加载配置时会替换为新连接池中的 Stmt
+func (stmt *Stmt) getConn() *sql.Stmt {
+	if stmt.pool == nil {
+		return stmt.conn
+	}
+	stmt.pool.lock.RLock()
+	defer stmt.pool.lock.RUnlock()
+	return stmt.conn
+}
+
 func (stmt *Stmt) Close() error {
-	if stmt.conn == nil {
+	// 先移除，避免重新加载配置时再替换
+	stmt.pool.removeStmt(stmt)
+	conn := stmt.getConn()
+	if conn == nil {
 		return errors.New("operate on a bad connection")
 	}
-	err := stmt.conn.Close()
+	err := conn.Close()
 	if err != nil {
 		stmt.logger.LogQueryError(err.Error(), *stmt.lastSql, stmt.lastArgs, -1)
 	}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"container/list"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ssgo/log"
+)
+
+// TenantConfig 多租户设置
+type TenantConfig struct {
+	Template    string        // 数据库连接模版，{tenant} 替换为租户ID，例如 sqlite://data/{tenant}.db
+	MaxPools    int           // 最多同时打开的连接池数量，超出时关闭最久未使用的，0表示不限制
+	IdleTimeout time.Duration // 连接池空闲超过该时间后关闭，0表示不关闭
+}
+
+type TenantRouter struct {
+	conf  TenantConfig
+	lock  sync.Mutex
+	pools map[string]*list.Element
+	lru   *list.List
+}
+
+type tenantPool struct {
+	tenant   string
+	db       *DB
+	lastUsed time.Time
+}
+
+var tenantIdMatcher = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+func NewTenantRouter(conf TenantConfig) (*TenantRouter, error) {
+	if !strings.Contains(conf.Template, "{tenant}") {
+		return nil, errors.New("tenant template must contains {tenant}")
+	}
+	return &TenantRouter{conf: conf, pools: make(map[string]*list.Element), lru: list.New()}, nil
+}
+
+// Get 获得租户的数据库操作实例，连接池在第一次使用时创建
+func (router *TenantRouter) Get(tenant string, logger *log.Logger) *DB {
+	if logger == nil {
+		logger = log.DefaultLogger
+	}
+	if !tenantIdMatcher.MatchString(tenant) {
+		logger.Error("invalid tenant id", "tenant", tenant)
+		return &DB{QuoteTag: "\"", Error: errors.New("invalid tenant id"), settings: newDBSettings()}
+	}
+
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	now := time.Now()
+	router.closeIdle(now)
+
+	if elem := router.pools[tenant]; elem != nil {
+		pool := elem.Value.(*tenantPool)
+		pool.lastUsed = now
+		router.lru.MoveToFront(elem)
+		return pool.db.CopyByLogger(logger)
+	}
+
+	db := GetDB(strings.ReplaceAll(router.conf.Template, "{tenant}", tenant), logger)
+	if db == nil || db.Error != nil {
+		return db
+	}
+	router.pools[tenant] = router.lru.PushFront(&tenantPool{tenant: tenant, db: db, lastUsed: now})
+	for router.conf.MaxPools > 0 && router.lru.Len() > router.conf.MaxPools {
+		router.remove(router.lru.Back())
+	}
+	return db.CopyByLogger(logger)
+}
+
+// Tenants 当前打开了连接池的租户
+func (router *TenantRouter) Tenants() []string {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	tenants := make([]string, 0, router.lru.Len())
+	for elem := router.lru.Front(); elem != nil; elem = elem.Next() {
+		tenants = append(tenants, elem.Value.(*tenantPool).tenant)
+	}
+	return tenants
+}
+
+// Close 关闭租户的连接池，正在执行的请求和事务结束后（最长 ReloadDrainTime）关闭
+func (router *TenantRouter) Close(tenant string) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if elem := router.pools[tenant]; elem != nil {
+		router.remove(elem)
+	}
+}
+
+// CloseAll 关闭所有租户的连接池
+func (router *TenantRouter) CloseAll() {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	for router.lru.Len() > 0 {
+		router.remove(router.lru.Back())
+	}
+}
+
+func (router *TenantRouter) closeIdle(now time.Time) {
+	if router.conf.IdleTimeout <= 0 {
+		return
+	}
+	for elem := router.lru.Back(); elem != nil; elem = router.lru.Back() {
+		if now.Sub(elem.Value.(*tenantPool).lastUsed) < router.conf.IdleTimeout {
+			break
+		}
+		router.remove(elem)
+	}
+}
+
+func (router *TenantRouter) remove(elem *list.Element) {
+	pool := router.lru.Remove(elem).(*tenantPool)
+	delete(router.pools, pool.tenant)
+	// 已经取出的实例中可能还有正在执行的请求，等待结束后再关闭
+	pool.db.destroyAfterDrain(ReloadDrainTime)
+}
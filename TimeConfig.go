@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeConfig time.Time、*time.Time、sql.NullTime 字段的读写设置
+type TimeConfig struct {
+	Location    *time.Location // 解析不带时区的时间时使用的时区，读取和写入的时间都会转换到该时区，默认为 UTC
+	Layouts     []string       // 解析字符串时优先尝试的格式，之后尝试 defaultTimeLayouts
+	WriteLayout string         // 写入时格式化为字符串，默认将 time.Time 直接交给驱动处理
+}
+
+// 按顺序尝试，解析时秒后面可以带有小数部分
+var defaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var nullTimeType = reflect.TypeOf(sql.NullTime{})
+
+// SetTimeConfig 设置时间字段的时区和格式，对使用同一连接池的所有 DB 对象生效
+func (db *DB) SetTimeConfig(conf TimeConfig) {
+	db.settings.lock.Lock()
+	db.settings.timeConfig = conf
+	db.settings.lock.Unlock()
+}
+
+func (settings *dbSettings) getTimeConfig() TimeConfig {
+	if settings == nil {
+		return TimeConfig{}
+	}
+	settings.lock.RLock()
+	defer settings.lock.RUnlock()
+	return settings.timeConfig
+}
+
+// 按设置的时区（默认为 UTC）获得当前时间，用于自动填充的时间
+func (conf TimeConfig) now() time.Time {
+	if conf.Location == nil {
+		return time.Now().UTC()
+	}
+	return time.Now().In(conf.Location)
+}
+
+// 自动填充时间时使用的格式
+func (conf TimeConfig) writeLayout() string {
+	if conf.WriteLayout == "" {
+		return "2006-01-02 15:04:05"
+	}
+	return conf.WriteLayout
+}
+
+func isTimeType(t reflect.Type) bool {
+	return t == timeType || t == nullTimeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType)
+}
+
+// 将驱动返回的值解析为时间，支持 time.Time、字符串和秒级或毫秒级的时间戳，isInt 为整数类型的字段时字符串才作为时间戳
+func (settings *dbSettings) parseTime(value interface{}, isInt bool) (time.Time, error) {
+	conf := settings.getTimeConfig()
+	loc := conf.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var str string
+	switch v := value.(type) {
+	case time.Time:
+		if conf.Location != nil {
+			return v.In(loc), nil
+		}
+		return v, nil
+	case int64:
+		return unixTime(v, loc), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).In(loc), nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return time.Time{}, fmt.Errorf("unsupported time value %T", value)
+	}
+
+	str = strings.TrimSpace(str)
+	for _, layouts := range [][]string{conf.Layouts, defaultTimeLayouts} {
+		for _, layout := range layouts {
+			if tm, err := time.ParseInLocation(layout, str, loc); err == nil {
+				if conf.Location != nil {
+					tm = tm.In(loc)
+				}
+				return tm, nil
+			}
+		}
+	}
+	if isInt {
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return unixTime(i, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as time", str)
+}
+
+// 大于 1e12 的时间戳按毫秒处理
+func unixTime(v int64, loc *time.Location) time.Time {
+	if v > 1e12 || v < -1e12 {
+		return time.UnixMilli(v).In(loc)
+	}
+	return time.Unix(v, 0).In(loc)
+}
+
+// 将时间设置到 time.Time、*time.Time、sql.NullTime 类型的字段
+func setTimeValue(field reflect.Value, tm time.Time) {
+	switch field.Type() {
+	case timeType:
+		field.Set(reflect.ValueOf(tm))
+	case nullTimeType:
+		field.Set(reflect.ValueOf(sql.NullTime{Time: tm, Valid: true}))
+	default:
+		field.Set(reflect.ValueOf(&tm))
+	}
+}
+
+// 按设置转换参数中的时间，sql.NullTime 无效时作为 NULL
+func (settings *dbSettings) makeTimeArgs(args []interface{}) []interface{} {
+	conf := settings.getTimeConfig()
+	for i, arg := range args {
+		var tm time.Time
+		switch v := arg.(type) {
+		case time.Time:
+			tm = v
+		case *time.Time:
+			if v == nil {
+				args[i] = nil
+				continue
+			}
+			tm = *v
+		case sql.NullTime:
+			if !v.Valid {
+				args[i] = nil
+				continue
+			}
+			tm = v.Time
+		default:
+			continue
+		}
+		if conf.Location != nil {
+			tm = tm.In(conf.Location)
+		}
+		if conf.WriteLayout != "" {
+			args[i] = tm.Format(conf.WriteLayout)
+		} else {
+			args[i] = tm
+		}
+	}
+	return args
+}
@@ -3,7 +3,6 @@ package db
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"time"
 )
 
@@ -16,6 +15,10 @@ type Tx struct {
 	logSlow                time.Duration
 	isCommitedOrRollbacked bool
 	QuoteTag               string
+	settings               *dbSettings
+	softDeleteMode         int
+	updateOptions          *UpdateOptions
+	use                    *poolUse
 }
 
 func (tx *Tx) Quote(text string) string {
@@ -34,6 +37,7 @@ func (tx *Tx) Commit() error {
 		return errors.New("operate on a bad connection")
 	}
 	err := tx.conn.Commit()
+	tx.release()
 	if err != nil {
 		tx.logger.LogQueryError(err.Error(), *tx.lastSql, tx.lastArgs, -1)
 	} else {
@@ -50,6 +54,7 @@ func (tx *Tx) Rollback() error {
 		return errors.New("operate on a bad connection")
 	}
 	err := tx.conn.Rollback()
+	tx.release()
 	//logError(err.Error(), *tx.lastSql, tx.lastArgs)
 	if err != nil {
 		tx.logger.LogQueryError(err.Error(), *tx.lastSql, tx.lastArgs, -1)
@@ -59,6 +64,14 @@ func (tx *Tx) Rollback() error {
 	return err
 }
 
+// 事务结束后不再计入连接池的活动请求
+func (tx *Tx) release() {
+	if tx.use != nil {
+		tx.use.release()
+		tx.use = nil
+	}
+}
+
 func (tx *Tx) Finish(ok bool) error {
 	if tx.isCommitedOrRollbacked {
 		return nil
@@ -85,6 +98,7 @@ func (tx *Tx) Prepare(requestSql string) *Stmt {
 	tx.lastSql = &requestSql
 	r := basePrepare(nil, tx.conn, requestSql)
 	r.logger = tx.logger
+	r.settings = tx.settings
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, -1)
 	}
@@ -94,8 +108,9 @@ func (tx *Tx) Prepare(requestSql string) *Stmt {
 func (tx *Tx) Exec(requestSql string, args ...interface{}) *ExecResult {
 	tx.lastSql = &requestSql
 	tx.lastArgs = args
-	r := baseExec(nil, tx.conn, requestSql, args...)
+	r := baseExec(nil, tx.conn, tx.settings, requestSql, args...)
 	r.logger = tx.logger
+	tx.logger.countQuery()
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
 	} else {
@@ -110,8 +125,9 @@ func (tx *Tx) Exec(requestSql string, args ...interface{}) *ExecResult {
 func (tx *Tx) Query(requestSql string, args ...interface{}) *QueryResult {
 	tx.lastSql = &requestSql
 	tx.lastArgs = args
-	r := baseQuery(nil, tx.conn, requestSql, args...)
+	r := baseQuery(nil, tx.conn, tx.settings, requestSql, args...)
 	r.logger = tx.logger
+	tx.logger.countQuery()
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
 	} else {
@@ -127,8 +143,9 @@ func (tx *Tx) Insert(table string, data interface{}) *ExecResult {
 	requestSql, values := tx.MakeInsertSql(table, data, false)
 	tx.lastSql = &requestSql
 	tx.lastArgs = values
-	r := baseExec(nil, tx.conn, requestSql, values...)
+	r := baseExec(nil, tx.conn, tx.settings, requestSql, values...)
 	r.logger = tx.logger
+	tx.logger.countQuery()
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
 	} else {
@@ -143,8 +160,31 @@ func (tx *Tx) Replace(table string, data interface{}) *ExecResult {
 	requestSql, values := tx.MakeInsertSql(table, data, true)
 	tx.lastSql = &requestSql
 	tx.lastArgs = values
-	r := baseExec(nil, tx.conn, requestSql, values...)
+	r := baseExec(nil, tx.conn, tx.settings, requestSql, values...)
+	r.logger = tx.logger
+	tx.logger.countQuery()
+	if r.Error != nil {
+		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
+	} else {
+		if tx.logSlow > 0 && r.usedTime >= float32(tx.logSlow/time.Millisecond) {
+			// 记录慢请求日志
+			tx.logger.LogQuery(*tx.lastSql, tx.lastArgs, r.usedTime)
+		}
+	}
+	return r
+}
+
+func (tx *Tx) InsertMany(table string, list interface{}) *ExecResult {
+	requestSql, values := makeInsertManySql(tx.settings, tx.QuoteTag, table, list, tx.updateOptions, false)
+	if requestSql == "" {
+		// 没有数据时不执行
+		return &ExecResult{Sql: &requestSql, logger: tx.logger}
+	}
+	tx.lastSql = &requestSql
+	tx.lastArgs = values
+	r := baseExec(nil, tx.conn, tx.settings, requestSql, values...)
 	r.logger = tx.logger
+	tx.logger.countQuery()
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
 	} else {
@@ -157,11 +197,17 @@ func (tx *Tx) Replace(table string, data interface{}) *ExecResult {
 }
 
 func (tx *Tx) Update(table string, data interface{}, wheres string, args ...interface{}) *ExecResult {
+	wheres = tx.settings.makeSoftDeleteWheres(tx.QuoteTag, table, wheres, tx.softDeleteMode)
 	requestSql, values := tx.MakeUpdateSql(table, data, wheres, args...)
+	if requestSql == "" {
+		tx.logger.LogError(ErrNoFieldsToUpdate.Error())
+		return &ExecResult{Sql: &requestSql, Args: args, logger: tx.logger, Error: ErrNoFieldsToUpdate}
+	}
 	tx.lastSql = &requestSql
 	tx.lastArgs = values
-	r := baseExec(nil, tx.conn, requestSql, values...)
+	r := baseExec(nil, tx.conn, tx.settings, requestSql, values...)
 	r.logger = tx.logger
+	tx.logger.countQuery()
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
 	} else {
@@ -174,14 +220,12 @@ func (tx *Tx) Update(table string, data interface{}, wheres string, args ...inte
 }
 
 func (tx *Tx) Delete(table string, wheres string, args ...interface{}) *ExecResult {
-	if wheres != "" {
-		wheres = " where " + wheres
-	}
-	requestSql := fmt.Sprintf("delete from %s%s", tx.Quote(table), wheres)
+	requestSql, args := tx.settings.makeDeleteSql(tx.QuoteTag, table, wheres, tx.softDeleteMode, args)
 	tx.lastSql = &requestSql
 	tx.lastArgs = args
-	r := baseExec(nil, tx.conn, requestSql, args...)
+	r := baseExec(nil, tx.conn, tx.settings, requestSql, args...)
 	r.logger = tx.logger
+	tx.logger.countQuery()
 	if r.Error != nil {
 		tx.logger.LogQueryError(r.Error.Error(), *tx.lastSql, tx.lastArgs, r.usedTime)
 	} else {
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+)
+
+// UpdateOptions 控制 Insert、Replace、InsertMany、Update 写入的字段
+// 结构体字段也可以使用 `db:",omitempty"` 标记为零值时不写入
+type UpdateOptions struct {
+	OmitZero bool     // 跳过零值字段，Map 中的 nil 也会跳过
+	Fields   []string // 只写入这些字段，不区分大小写
+	Exclude  []string // 不写入这些字段，不区分大小写
+}
+
+// WithUpdateOptions 返回按 opt 写入部分字段的操作实例，之后 Begin 的事务也使用相同的设置
+func (db *DB) WithUpdateOptions(opt UpdateOptions) *DB {
+	newDB := db.CopyByLogger(db.logger.logger)
+	newDB.updateOptions = &opt
+	return newDB
+}
+
+// MakeKeysVarsValuesWithOptions 同 MakeKeysVarsValues，按 opt 过滤字段
+func MakeKeysVarsValuesWithOptions(data interface{}, opt *UpdateOptions) ([]string, []string, []interface{}) {
+	return makeKeysVarsValues(data, opt, nil)
+}
+
+func containsAnyFold(list []string, keys []string) bool {
+	for _, k := range list {
+		for _, key := range keys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 判断字段是否需要跳过，omitEmpty 为字段上的 omitempty 标记，names 为结构体字段名和数据库字段名
+func (opt *UpdateOptions) skip(v reflect.Value, omitEmpty bool, names ...string) bool {
+	if opt != nil {
+		if len(opt.Fields) > 0 && !containsAnyFold(opt.Fields, names) {
+			return true
+		}
+		if containsAnyFold(opt.Exclude, names) {
+			return true
+		}
+		omitEmpty = omitEmpty || opt.OmitZero
+	}
+	if omitEmpty {
+		return !v.IsValid() || v.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrStaleObject 乐观锁更新失败，数据已被其他操作修改
+var ErrStaleObject = errors.New("stale object")
+
+// DefaultVersionColumn 使用 Map 更新时的版本字段
+var DefaultVersionColumn = "version"
+
+// UpdateVersioned 带版本检查的更新，结构体中使用 `db:",version"` 标记版本字段，Map 使用 DefaultVersionColumn
+// 更新时附加 version=? 条件并将 version 加一，未更新到数据时返回 ErrStaleObject
+func (db *DB) UpdateVersioned(table string, data interface{}, wheres string, args ...interface{}) *ExecResult {
+	wheres = db.settings.makeSoftDeleteWheres(db.QuoteTag, table, wheres, db.softDeleteMode)
+	requestSql, values, versionField, err := makeVersionedUpdateSql(db.settings, db.QuoteTag, table, data, db.updateOptions, wheres, args...)
+	if err != nil {
+		db.logger.LogError(err.Error())
+		return &ExecResult{Sql: &requestSql, Args: args, logger: db.logger, Error: err}
+	}
+	r := db.Exec(requestSql, values...)
+	finishVersionedUpdate(r, versionField)
+	return r
+}
+
+func (tx *Tx) UpdateVersioned(table string, data interface{}, wheres string, args ...interface{}) *ExecResult {
+	wheres = tx.settings.makeSoftDeleteWheres(tx.QuoteTag, table, wheres, tx.softDeleteMode)
+	requestSql, values, versionField, err := makeVersionedUpdateSql(tx.settings, tx.QuoteTag, table, data, tx.updateOptions, wheres, args...)
+	if err != nil {
+		tx.logger.LogError(err.Error())
+		return &ExecResult{Sql: &requestSql, Args: args, logger: tx.logger, Error: err}
+	}
+	r := tx.Exec(requestSql, values...)
+	finishVersionedUpdate(r, versionField)
+	return r
+}
+
+func finishVersionedUpdate(r *ExecResult, versionField reflect.Value) {
+	if r.Error != nil {
+		return
+	}
+	if r.Changes() == 0 {
+		r.Error = ErrStaleObject
+		return
+	}
+
+	// 同步结构体中的版本号
+	if versionField.IsValid() && versionField.CanSet() {
+		switch versionField.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			versionField.SetInt(versionField.Int() + 1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			versionField.SetUint(versionField.Uint() + 1)
+		}
+	}
+}
+
+func makeVersionedUpdateSql(settings *dbSettings, quoteTag string, table string, data interface{}, opt *UpdateOptions, wheres string, args ...interface{}) (string, []interface{}, reflect.Value, error) {
+	mapper := settings.getNameMapper()
+	versionColumn, versionField := findVersionField(data, mapper)
+	args = flatArgs(args)
+
+	// 版本号不受 opt 的影响
+	allKeys, allVars, allValues := makeKeysVarsValues(data, nil, settings)
+	versionIndex, valueIndex := findKeyIndex(allKeys, allVars, versionColumn)
+	if versionIndex == -1 || valueIndex == -1 {
+		return "", nil, versionField, fmt.Errorf("version column %s not found in data", versionColumn)
+	}
+	versionColumn = allKeys[versionIndex]
+	versionValue := allValues[valueIndex]
+
+	keys, vars, values := makeKeysVarsValues(data, opt, settings)
+	if versionIndex, valueIndex := findKeyIndex(keys, vars, versionColumn); versionIndex != -1 {
+		keys, vars, values = removeKey(keys, vars, values, versionIndex, valueIndex)
+	}
+	keys, vars, values = settings.fillAutoTime(table, data, keys, vars, values, true)
+
+	sets := make([]string, 0, len(keys)+1)
+	for i, k := range keys {
+		sets = append(sets, fmt.Sprintf("%s=%s", quote(quoteTag, k), vars[i]))
+	}
+	quotedVersion := quote(quoteTag, versionColumn)
+	sets = append(sets, fmt.Sprintf("%s=%s+1", quotedVersion, quotedVersion))
+
+	// version=? 追加在尾部子句之前，参数也需要放在尾部子句的参数之前
+	headArgs := len(args)
+	if pos := findWheresTail(wheres); pos != -1 {
+		headArgs -= strings.Count(wheres[pos:], "?")
+		if headArgs < 0 {
+			headArgs = 0
+		}
+	}
+	values = append(values, args[:headArgs]...)
+	values = append(values, versionValue)
+	values = append(values, args[headArgs:]...)
+	wheres = appendWheres(wheres, quotedVersion+"=?")
+	requestSql := fmt.Sprintf("update %s set %s%s", quote(quoteTag, table), strings.Join(sets, ","), makeWheresClause(wheres))
+	return requestSql, values, versionField, nil
+}
+
+// 查找结构体中标记为 version 的字段，返回数据库字段名
+func findVersionField(data interface{}, mapper *NameMapper) (string, reflect.Value) {
+	dataValue := reflect.ValueOf(data)
+	for dataValue.Kind() == reflect.Ptr {
+		dataValue = dataValue.Elem()
+	}
+	if dataValue.Kind() == reflect.Struct {
+		if column, field := findTaggedField(dataValue, "version", mapper); column != "" {
+			return column, field
+		}
+	}
+	return DefaultVersionColumn, reflect.Value{}
+}
+
+// 查找带有 option 标记的字段，返回数据库字段名
+func findTaggedField(value reflect.Value, option string, mapper *NameMapper) (string, reflect.Value) {
+	valueType := value.Type()
+	for i := 0; i < value.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if column, v := findTaggedField(value.Field(i), option, mapper); column != "" {
+				return column, v
+			}
+			continue
+		}
+		if tag := field.Tag.Get("db"); hasTagOption(tag, option) {
+			return tagColumnName(tag, field.Name, mapper), value.Field(i)
+		}
+	}
+	return "", reflect.Value{}
+}
+
+// `db:"name,..."` 中设置了字段名时使用该名称，否则按 mapper 转换结构体字段名
+func tagColumnName(tag string, fieldName string, mapper *NameMapper) string {
+	if name := tagName(tag); name != "" {
+		return name
+	}
+	return mapper.columnName(fieldName)
+}
+
+// 解析 `db:"name,option1,option2"` 中的字段名，"-" 作为没有设置
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	if name = strings.TrimSpace(name); name == "-" {
+		return ""
+	}
+	return name
+}
+
+// 解析 `db:"name,option1,option2"` 中的选项
+func hasTagOption(tag string, option string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, opt := range strings.Split(tag, ",")[1:] {
+		if strings.TrimSpace(opt) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析 `db:",option=value"` 中选项的值
+func getTagOption(tag string, option string) (string, bool) {
+	if tag == "" {
+		return "", false
+	}
+	for _, opt := range strings.Split(tag, ",")[1:] {
+		if name, value, ok := strings.Cut(strings.TrimSpace(opt), "="); ok && name == option {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,143 @@
+// 测试辅助工具，创建独立的 sqlite 数据库、执行 migration、加载 fixture，以及每个测试结束后回滚的事务
+package dbtest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ssgo/db"
+	"github.com/ssgo/u"
+	"gopkg.in/yaml.v3"
+
+	_ "modernc.org/sqlite"
+)
+
+type Options struct {
+	Memory     bool     // 使用内存数据库，否则在 t.TempDir() 中创建数据库文件
+	Migrations []string // migration 文件或目录（按文件名顺序执行目录中的 .sql 文件）
+	Fixtures   []string // JSON 或 YAML 格式的 fixture 文件，{"表名": [{...}, ...]}
+}
+
+// 支持 *db.DB 和 *db.Tx
+type Inserter interface {
+	InsertMany(table string, list interface{}) *db.ExecResult
+}
+
+// 创建一个新的 sqlite 数据库，测试结束时自动释放
+func Open(t testing.TB, opt *Options) *db.DB {
+	t.Helper()
+	if opt == nil {
+		opt = &Options{}
+	}
+	var dsn string
+	if opt.Memory {
+		// 内存数据库每个连接都是独立的，只能使用一个连接
+		dsn = "sqlite://:memory:?maxOpens=1&maxIdles=1&dbtest=" + u.UniqueId()
+	} else {
+		dsn = "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	}
+	conn := db.GetDB(dsn, nil)
+	if conn == nil || conn.Error != nil {
+		t.Fatal("open test db failed", conn)
+	}
+	t.Cleanup(func() {
+		_ = conn.Destroy()
+	})
+
+	if err := Migrate(conn, opt.Migrations...); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFixtures(conn, opt.Fixtures...); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// 开始一个事务，测试结束时回滚，用于多个测试共享同一个数据库
+func Transactional(t testing.TB, conn *db.DB) *db.Tx {
+	t.Helper()
+	tx := conn.Begin()
+	if tx.Error != nil {
+		t.Fatal("begin test tx failed", tx.Error)
+	}
+	t.Cleanup(func() {
+		_ = tx.Rollback()
+	})
+	return tx
+}
+
+// 执行 migration 文件，目录中的 .sql 文件按文件名顺序执行
+func Migrate(conn *db.DB, paths ...string) error {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		dirFiles, err := filepath.Glob(filepath.Join(path, "*.sql"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(buf)) == "" {
+			continue
+		}
+		if r := conn.Exec(string(buf)); r.Error != nil {
+			return fmt.Errorf("migrate %s failed: %w", file, r.Error)
+		}
+	}
+	return nil
+}
+
+// 按文件中表的顺序插入数据
+func LoadFixtures(conn Inserter, files ...string) error {
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		// JSON 也可以按 YAML 解析，并且保留表的顺序
+		doc := yaml.Node{}
+		if err := yaml.NewDecoder(bytes.NewReader(buf)).Decode(&doc); err != nil {
+			return fmt.Errorf("load fixture %s failed: %w", file, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		tables := doc.Content[0]
+		if tables.Kind != yaml.MappingNode {
+			return fmt.Errorf("load fixture %s failed: must be a map of table to rows", file)
+		}
+		for i := 0; i+1 < len(tables.Content); i += 2 {
+			table := tables.Content[i].Value
+			rows := make([]map[string]interface{}, 0)
+			if err := tables.Content[i+1].Decode(&rows); err != nil {
+				return fmt.Errorf("load fixture %s table %s failed: %w", file, table, err)
+			}
+			if len(rows) == 0 {
+				continue
+			}
+			if r := conn.InsertMany(table, rows); r.Error != nil {
+				return fmt.Errorf("load fixture %s table %s failed: %w", file, table, r.Error)
+			}
+		}
+	}
+	return nil
+}
@@ -4,10 +4,10 @@ go 1.23.0
 
 require (
 	github.com/go-sql-driver/mysql v1.9.3
-	github.com/mitchellh/mapstructure v1.5.0
 	github.com/ssgo/config v1.7.9
 	github.com/ssgo/log v1.7.7
 	github.com/ssgo/u v1.7.19
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.38.0
 )
 
@@ -21,7 +21,6 @@ require (
 	github.com/ssgo/standard v1.7.7 // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
 	golang.org/x/sys v0.33.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	modernc.org/libc v1.66.1 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect